@@ -0,0 +1,118 @@
+package redistore
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SaveAck requires saves to be acknowledged by replicas with WAIT, so a
+// session survives a failover right after it is saved.
+//
+// Fields:
+//
+//	Replicas: Replicas that must acknowledge the save. Defaults to 1.
+//	Timeout: How long to wait for them. Defaults to 500 milliseconds; it
+//	  should stay below the client's ReadTimeout.
+type SaveAck struct {
+	Replicas int
+	Timeout  time.Duration
+}
+
+// AckError is returned by Save when fewer replicas than required
+// acknowledged the save before the timeout. The session is stored on the
+// primary and its cookie is set, so the error may be ignored or acted upon,
+// e.g. by delaying a redirect. Middleware ignores it.
+type AckError struct {
+	Acked  int
+	Wanted int
+}
+
+func (e *AckError) Error() string {
+	return fmt.Sprintf("redistore: save acknowledged by %d of %d replicas", e.Acked, e.Wanted)
+}
+
+// SetSaveAck makes every save wait for replica acknowledgment. A nil ack,
+// the default, does not wait. WithSaveAck overrides it per request.
+func (s *RediStore) SetSaveAck(ack *SaveAck) {
+	s.ack = newSaveAck(ack)
+}
+
+// saveAckKey is the context key of the SaveAck set with WithSaveAck.
+type saveAckKey struct{}
+
+// WithSaveAck returns a shallow copy of r whose saves wait for replica
+// acknowledgment as set by ack, or do not wait if ack is nil, regardless of
+// SetSaveAck. Pass it to Save, e.g. when saving the session created by a
+// login:
+//
+//	err := session.Save(redistore.WithSaveAck(r, &redistore.SaveAck{Replicas: 1}), w)
+//
+// The registry of sessions.GetRegistry is tied to r, so sessions.Save should
+// be called with the original request.
+func WithSaveAck(r *http.Request, ack *SaveAck) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), saveAckKey{}, newSaveAck(ack)))
+}
+
+// newSaveAck returns a copy of ack with defaults applied.
+func newSaveAck(ack *SaveAck) *SaveAck {
+	if ack == nil {
+		return nil
+	}
+	a := *ack
+	if a.Replicas <= 0 {
+		a.Replicas = 1
+	}
+	if a.Timeout <= 0 {
+		a.Timeout = 500 * time.Millisecond
+	}
+	return &a
+}
+
+// saveAck returns the acknowledgment required for saves made with r.
+func (s *RediStore) saveAck(r *http.Request) *SaveAck {
+	if r != nil {
+		if ack, ok := r.Context().Value(saveAckKey{}).(*SaveAck); ok {
+			return ack
+		}
+	}
+	return s.ack
+}
+
+// ackClient returns the client to send writes to key with when they are
+// followed by WAIT. WAIT covers the writes made on its connection, so on a
+// cluster, where go-redis would route it by its first argument as if it were
+// a key, the writes and WAIT are pipelined to the master of key.
+func (s *RediStore) ackClient(ctx context.Context, key string) (redis.Cmdable, error) {
+	if c, ok := s.Client.(*redis.ClusterClient); ok {
+		return c.MasterForKey(ctx, key)
+	}
+	return s.Client, nil
+}
+
+// queue adds a WAIT to a pipeline of writes, returning nil for a nil ack.
+func (a *SaveAck) queue(ctx context.Context, p redis.Pipeliner) *redis.Cmd {
+	if a == nil {
+		return nil
+	}
+	return p.Do(ctx, "wait", a.Replicas, a.Timeout.Milliseconds())
+}
+
+// check returns an AckError if the WAIT queued by queue was not
+// acknowledged by enough replicas.
+func (a *SaveAck) check(wait *redis.Cmd) error {
+	if a == nil || wait == nil {
+		return nil
+	}
+	n, err := wait.Int()
+	if err != nil {
+		return err
+	}
+	if n < a.Replicas {
+		return &AckError{Acked: n, Wanted: a.Replicas}
+	}
+	return nil
+}
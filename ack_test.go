@@ -0,0 +1,96 @@
+package redistore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"github.com/poseidonphp/redistore/redistoretest/redisserver"
+)
+
+func TestSaveAck(t *testing.T) {
+	ctx := context.Background()
+	srv, err := redisserver.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := srv.Close(); err != nil {
+			fmt.Printf("Error closing server: %v\n", err)
+		}
+	}()
+	store, err := NewRediStore([]string{srv.URL()}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	req := httptest.NewRequest("GET", "http://localhost/", nil)
+	save := func(r *http.Request, values map[interface{}]interface{}) (*sessions.Session, string, error) {
+		session := sessions.NewSession(store, "session-key")
+		session.Options = &sessions.Options{MaxAge: 60}
+		for k, v := range values {
+			session.Values[k] = v
+		}
+		rsp := httptest.NewRecorder()
+		err := store.Save(r, rsp, session)
+		return session, rsp.Header().Get("Set-Cookie"), err
+	}
+
+	// Without an ack, saves do not wait.
+	if _, _, err := save(req, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Too few acknowledgments are reported, but the session is saved.
+	store.SetSaveAck(&SaveAck{})
+	session, cookie, err := save(req, map[interface{}]interface{}{"n": 1})
+	var ackErr *AckError
+	if !errors.As(err, &ackErr) || ackErr.Acked != 0 || ackErr.Wanted != 1 {
+		t.Errorf("Expected an AckError for 0 of 1; Got %v", err)
+	}
+	if cookie == "" {
+		t.Error("Expected the cookie to be set")
+	}
+	if _, err := store.LookupSession(ctx, session.ID); err != nil {
+		t.Errorf("Expected the session to be stored; Got %v", err)
+	}
+	srv.SetReplicas(1)
+	if _, _, err := save(req, nil); err != nil {
+		t.Errorf("Expected the save to be acknowledged; Got %v", err)
+	}
+
+	// WithSaveAck overrides the store's ack.
+	if _, _, err := save(WithSaveAck(req, &SaveAck{Replicas: 2}), nil); !errors.As(err, &ackErr) || ackErr.Wanted != 2 {
+		t.Errorf("Expected an AckError for 2 replicas; Got %v", err)
+	}
+	srv.SetReplicas(0)
+	if _, _, err := save(WithSaveAck(req, nil), nil); err != nil {
+		t.Errorf("Expected the save not to wait; Got %v", err)
+	}
+
+	// Indexed sessions and their metadata are waited for as well.
+	store.SetUserIDFunc(UserIDFromValue("user_id"))
+	store.SetSessionMetadata(true)
+	session, _, err = save(req, map[interface{}]interface{}{"user_id": 42})
+	if !errors.As(err, &ackErr) {
+		t.Errorf("Expected an AckError; Got %v", err)
+	}
+	if md, err := store.Metadata(ctx, session); err != nil || md == nil {
+		t.Errorf("Expected the metadata to be stored; Got %v, %v", md, err)
+	}
+	if ids, err := store.ListUserSessions(ctx, "42"); err != nil || len(ids) != 1 {
+		t.Errorf("Expected the session to be indexed; Got %v, %v", ids, err)
+	}
+	srv.SetReplicas(1)
+	if _, _, err := save(req, map[interface{}]interface{}{"user_id": 42}); err != nil {
+		t.Errorf("Expected the save to be acknowledged; Got %v", err)
+	}
+}
@@ -0,0 +1,235 @@
+/*
+Package admin provides an http.Handler for inspecting and revoking the
+sessions held by a redistore.RediStore.
+
+All endpoints speak JSON and are relative to where the handler is mounted:
+
+	GET    /sessions?prefix=&user=&limit=   list sessions by ID prefix or user
+	GET    /sessions/{id}                   show TTL, metadata and values
+	DELETE /sessions/{id}                   revoke a session
+	POST   /sessions/{id}/extend            set the TTL, body {"ttl_seconds": N}
+	DELETE /users/{user}/sessions           revoke every session of a user
+
+Listing by user and revoking by user require the store's user index, see
+RediStore.SetUserIDFunc.
+*/
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/poseidonphp/redistore"
+)
+
+// defaultLimit caps the number of sessions returned by a listing when the
+// request does not specify one.
+const defaultLimit = 100
+
+// Redacted replaces values hidden by a RedactFunc.
+const Redacted = "[REDACTED]"
+
+// RedactFunc decides how a session value is shown. It returns the value to
+// display in place of value, typically either value itself or Redacted.
+type RedactFunc func(key string, value interface{}) interface{}
+
+// RedactAll hides every session value. It is used when Options.Redact is nil.
+func RedactAll(string, interface{}) interface{} {
+	return Redacted
+}
+
+// RedactKeys returns a RedactFunc hiding the values of the given keys and
+// showing all others.
+func RedactKeys(keys ...string) RedactFunc {
+	hidden := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		hidden[k] = true
+	}
+	return func(key string, value interface{}) interface{} {
+		if hidden[key] {
+			return Redacted
+		}
+		return value
+	}
+}
+
+// Options configures a Handler.
+//
+// Fields:
+//
+//	Authorize: Called for every request; the request is refused with 403
+//	  Forbidden unless it returns true. A nil Authorize refuses everything.
+//	Redact: Decides how session values are shown. Nil hides all values.
+type Options struct {
+	Authorize func(r *http.Request) bool
+	Redact    RedactFunc
+}
+
+// Handler serves the admin endpoints for a RediStore.
+type Handler struct {
+	store *redistore.RediStore
+	opts  Options
+	mux   *http.ServeMux
+}
+
+// NewHandler returns a Handler operating on store.
+func NewHandler(store *redistore.RediStore, opts Options) *Handler {
+	if opts.Redact == nil {
+		opts.Redact = RedactAll
+	}
+	h := &Handler{store: store, opts: opts, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET /sessions", h.list)
+	h.mux.HandleFunc("GET /sessions/{id}", h.show)
+	h.mux.HandleFunc("DELETE /sessions/{id}", h.revoke)
+	h.mux.HandleFunc("POST /sessions/{id}/extend", h.extend)
+	h.mux.HandleFunc("DELETE /users/{user}/sessions", h.revokeUser)
+	return h
+}
+
+// ServeHTTP authorizes the request and dispatches it to the endpoint.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.opts.Authorize == nil || !h.opts.Authorize(r) {
+		writeError(w, http.StatusForbidden, errors.New("forbidden"))
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+// session is the JSON representation of a session.
+type session struct {
+	ID         string                 `json:"id"`
+	TTLSeconds int64                  `json:"ttl_seconds"`
+	Metadata   *redistore.Metadata    `json:"metadata,omitempty"`
+	Values     map[string]interface{} `json:"values,omitempty"`
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := defaultLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, errors.New("invalid limit"))
+			return
+		}
+		limit = n
+	}
+
+	out := []session{}
+	if user := q.Get("user"); user != "" {
+		recs, err := h.store.UserSessionRecordsRaw(r.Context(), user)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		for _, rec := range recs {
+			if len(out) == limit {
+				break
+			}
+			out = append(out, h.summary(rec))
+		}
+	} else {
+		opts := redistore.ScanOptions{Load: true, Raw: true, IDPrefix: q.Get("prefix")}
+		err := h.store.Scan(r.Context(), opts, func(rec *redistore.SessionRecord) error {
+			out = append(out, h.summary(rec))
+			if len(out) == limit {
+				return redistore.ErrStopScan
+			}
+			return nil
+		})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"sessions": out})
+}
+
+func (h *Handler) show(w http.ResponseWriter, r *http.Request) {
+	rec, err := h.store.LookupSession(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	out := h.summary(rec)
+	out.Values = make(map[string]interface{}, len(rec.Values))
+	for k, v := range rec.Values {
+		key := fmt.Sprint(k)
+		out.Values[key] = jsonSafe(h.opts.Redact(key, v))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (h *Handler) revoke(w http.ResponseWriter, r *http.Request) {
+	if err := h.store.DestroySession(r.Context(), r.PathValue("id")); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) extend(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		TTLSeconds int64 `json:"ttl_seconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.TTLSeconds <= 0 {
+		writeError(w, http.StatusBadRequest, errors.New("body must be {\"ttl_seconds\": N} with N > 0"))
+		return
+	}
+	id := r.PathValue("id")
+	if err := h.store.ExtendSession(r.Context(), id, time.Duration(body.TTLSeconds)*time.Second); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, session{ID: id, TTLSeconds: body.TTLSeconds})
+}
+
+func (h *Handler) revokeUser(w http.ResponseWriter, r *http.Request) {
+	n, err := h.store.DestroyUserSessions(r.Context(), r.PathValue("user"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"revoked": n})
+}
+
+// summary converts rec to its JSON representation without values.
+func (h *Handler) summary(rec *redistore.SessionRecord) session {
+	return session{
+		ID:         rec.ID,
+		TTLSeconds: int64(rec.TTL / time.Second),
+		Metadata:   rec.Metadata,
+	}
+}
+
+// jsonSafe returns v if it can be encoded as JSON, or its string form
+// otherwise, so a single exotic value cannot break the whole response.
+func jsonSafe(v interface{}) interface{} {
+	if _, err := json.Marshal(v); err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return v
+}
+
+// writeStoreError maps an error returned by the store to a response.
+func writeStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, redistore.ErrSessionNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,169 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/poseidonphp/redistore"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultRedisURL = "redis://localhost:6379"
+)
+
+func setup(t *testing.T) *redistore.RediStore {
+	addr := os.Getenv("REDIS_URL")
+	if addr == "" {
+		addr = defaultRedisURL
+	}
+	store, err := redistore.NewRediStore([]string{addr}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	store.SetKeyPrefix("admin_test_")
+	store.SetUserIDFunc(redistore.UserIDFromValue("user_id"))
+	store.SetSessionMetadata(true)
+	return store
+}
+
+func saveSession(t *testing.T, store *redistore.RediStore, uid string) string {
+	t.Helper()
+	req := httptest.NewRequest("GET", "http://localhost:8080/", nil)
+	session, _ := store.New(req, "session-key")
+	session.Values["user_id"] = uid
+	session.Values["token"] = "s3cr3t"
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	return session.ID
+}
+
+func do(t *testing.T, h http.Handler, method, target, body string, out interface{}) int {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	rsp := httptest.NewRecorder()
+	h.ServeHTTP(rsp, req)
+	if out != nil {
+		if err := json.Unmarshal(rsp.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: invalid JSON %q: %v", method, target, rsp.Body.String(), err)
+		}
+	}
+	return rsp.Code
+}
+
+func TestHandler(t *testing.T) {
+	store := setup(t)
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	defer store.DestroyUserSessions(context.Background(), "hank")
+	defer store.DestroyUserSessions(context.Background(), "iris")
+
+	h := NewHandler(store, Options{
+		Authorize: func(r *http.Request) bool { return true },
+		Redact:    RedactKeys("token"),
+	})
+	id := saveSession(t, store, "hank")
+	broken := saveSession(t, store, "hank")
+	other := saveSession(t, store, "iris")
+	// Listing does not decode values, so an undecodable session is listed.
+	if err := store.Client.SetArgs(context.Background(), "admin_test_"+broken, "garbage", redis.SetArgs{KeepTTL: true}).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	var list struct {
+		Sessions []session `json:"sessions"`
+	}
+	if code := do(t, h, "GET", "/sessions?user=hank", "", &list); code != http.StatusOK || len(list.Sessions) != 2 {
+		t.Fatalf("Expected 2 sessions; Got %d %+v", code, list)
+	}
+	if md := list.Sessions[0].Metadata; md == nil || md.Name != "session-key" {
+		t.Errorf("Expected metadata; Got %+v", md)
+	}
+	if code := do(t, h, "GET", "/sessions?prefix="+broken, "", &list); code != http.StatusOK ||
+		len(list.Sessions) != 1 || list.Sessions[0].ID != broken {
+		t.Errorf("Expected session %q by prefix; Got %d %+v", broken, code, list)
+	}
+	if code := do(t, h, "GET", "/sessions?limit=1&prefix="+other[:10], "", &list); code != http.StatusOK ||
+		len(list.Sessions) != 1 || list.Sessions[0].ID != other {
+		t.Errorf("Expected session %q by prefix; Got %d %+v", other, code, list)
+	}
+
+	var shown session
+	if code := do(t, h, "GET", "/sessions/"+id, "", &shown); code != http.StatusOK {
+		t.Fatalf("Expected 200; Got %d", code)
+	}
+	if shown.Values["user_id"] != "hank" || shown.Values["token"] != Redacted || shown.TTLSeconds <= 0 {
+		t.Errorf("Unexpected session %+v", shown)
+	}
+
+	if code := do(t, h, "POST", "/sessions/"+id+"/extend", `{"ttl_seconds": 60}`, &shown); code != http.StatusOK {
+		t.Errorf("Expected 200; Got %d", code)
+	}
+	if rec, _ := store.LookupSession(context.Background(), id); rec == nil || rec.TTL.Seconds() > 60 {
+		t.Errorf("Expected TTL to be set to 60s; Got %+v", rec)
+	}
+	if code := do(t, h, "POST", "/sessions/"+id+"/extend", `{}`, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected 400; Got %d", code)
+	}
+
+	if code := do(t, h, "DELETE", "/sessions/"+id, "", nil); code != http.StatusNoContent {
+		t.Errorf("Expected 204; Got %d", code)
+	}
+	if code := do(t, h, "GET", "/sessions/"+id, "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404; Got %d", code)
+	}
+
+	var revoked map[string]int
+	if code := do(t, h, "DELETE", "/users/hank/sessions", "", &revoked); code != http.StatusOK || revoked["revoked"] != 1 {
+		t.Errorf("Expected 1 revoked session; Got %d %v", code, revoked)
+	}
+}
+
+func TestHandlerAuthorization(t *testing.T) {
+	store := setup(t)
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+
+	for _, authorize := range []func(*http.Request) bool{
+		nil,
+		func(r *http.Request) bool { return r.Header.Get("X-Admin") == "yes" },
+	} {
+		h := NewHandler(store, Options{Authorize: authorize})
+		if code := do(t, h, "GET", "/sessions", "", nil); code != http.StatusForbidden {
+			t.Errorf("Expected 403; Got %d", code)
+		}
+	}
+}
+
+func TestRedactAll(t *testing.T) {
+	store := setup(t)
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	defer store.DestroyUserSessions(context.Background(), "jane")
+
+	id := saveSession(t, store, "jane")
+	h := NewHandler(store, Options{Authorize: func(*http.Request) bool { return true }})
+	var shown session
+	do(t, h, "GET", "/sessions/"+id, "", &shown)
+	for k, v := range shown.Values {
+		if v != Redacted {
+			t.Errorf("Expected %q to be redacted; Got %v", k, v)
+		}
+	}
+}
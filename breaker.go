@@ -0,0 +1,369 @@
+package redistore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/redis/go-redis/v9"
+)
+
+// FallbackMode is what a RediStore does while its circuit breaker is open.
+type FallbackMode int
+
+const (
+	// FallbackAnonymous gives every request a fresh, empty session and
+	// drops saves and deletes without error.
+	FallbackAnonymous FallbackMode = iota
+	// FallbackReadOnly keeps loading sessions from Redis, returning a fresh
+	// session without error if that fails, but drops saves and deletes.
+	// Loads do not update the metadata or LRU index of the sessions either.
+	// It suits failures that affect writes only, like a replica that has not
+	// yet been promoted, so only writes drive the breaker in this mode.
+	FallbackReadOnly
+	// FallbackCookie loads and saves sessions with
+	// CircuitBreakerOptions.Store, typically a sessions.CookieStore, so
+	// small sessions keep working. Once Redis is back, sessions found in
+	// fallback cookies are moved into new Redis sessions on load.
+	FallbackCookie
+)
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState int
+
+const (
+	// CircuitClosed sends every operation to Redis.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen sends every operation to the fallback.
+	CircuitOpen
+	// CircuitHalfOpen lets one probe operation at a time through to Redis,
+	// sending the others to the fallback.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreakerOptions configures the circuit breaker of a RediStore.
+//
+// Fields:
+//
+//	Threshold: Consecutive failed operations that open the circuit.
+//	  Defaults to 5.
+//	Cooldown: How long the circuit stays open before probing Redis again.
+//	  Defaults to 30 seconds.
+//	Probes: Consecutive successful probes that close the circuit.
+//	  Defaults to 1.
+//	Fallback: What to do while the circuit is open.
+//	Store: The store FallbackCookie loads and saves sessions with. Its
+//	  cookies must not decode with the RediStore's codecs, which holds for
+//	  a sessions.CookieStore.
+//	IsFailure: Reports whether an error counts as a backend failure.
+//	  Defaults to IsTransientError, so errors like a session too big to
+//	  store do not open the circuit.
+//	OnStateChange: Called, if set, whenever the circuit changes state.
+type CircuitBreakerOptions struct {
+	Threshold     int
+	Cooldown      time.Duration
+	Probes        int
+	Fallback      FallbackMode
+	Store         sessions.Store
+	IsFailure     func(err error) bool
+	OnStateChange func(from, to CircuitState)
+}
+
+// SetCircuitBreaker puts a circuit breaker in front of Redis for New, Save
+// and Delete, so a Redis outage degrades sessions instead of failing every
+// request. After opts.Threshold consecutive backend failures the circuit
+// opens and operations use opts.Fallback. After opts.Cooldown probe
+// operations go to Redis again, and the circuit closes once opts.Probes of
+// them succeed in a row. A nil opts removes the breaker.
+//
+// Operations are still attempted, and their errors returned, until the
+// circuit opens. Other methods, like Scan or DestroySession, are not
+// affected by the breaker.
+func (s *RediStore) SetCircuitBreaker(opts *CircuitBreakerOptions) error {
+	if opts == nil {
+		s.breaker = nil
+		return nil
+	}
+	o := *opts
+	if o.Fallback == FallbackCookie && o.Store == nil {
+		return errors.New("redistore: FallbackCookie needs a Store")
+	}
+	if o.Threshold <= 0 {
+		o.Threshold = 5
+	}
+	if o.Cooldown <= 0 {
+		o.Cooldown = 30 * time.Second
+	}
+	if o.Probes <= 0 {
+		o.Probes = 1
+	}
+	if o.IsFailure == nil {
+		o.IsFailure = IsTransientError
+	}
+	s.breaker = &circuitBreaker{store: s, opts: o, now: time.Now}
+	return nil
+}
+
+// CircuitState returns the state of the circuit breaker, CircuitClosed if
+// there is none.
+func (s *RediStore) CircuitState() CircuitState {
+	if s.breaker == nil {
+		return CircuitClosed
+	}
+	s.breaker.mu.Lock()
+	defer s.breaker.unlock()
+	return s.breaker.stateLocked()
+}
+
+// IsTransientError reports whether err indicates that Redis is unreachable
+// or temporarily unable to serve requests: network errors and timeouts,
+// closed connections and pools, and the LOADING, READONLY, MASTERDOWN,
+// CLUSTERDOWN and TRYAGAIN errors. A context canceled by the caller is not
+// transient.
+func IsTransientError(err error) bool {
+	switch {
+	case err == nil, errors.Is(err, redis.Nil), errors.Is(err, context.Canceled):
+		return false
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, redis.ErrClosed),
+		errors.Is(err, redis.ErrPoolTimeout),
+		errors.Is(err, redis.ErrPoolExhausted),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.EPIPE):
+		return true
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return true
+	}
+	var re redis.Error
+	if errors.As(err, &re) {
+		for _, prefix := range []string{"LOADING ", "READONLY ", "MASTERDOWN ", "CLUSTERDOWN ", "TRYAGAIN "} {
+			if strings.HasPrefix(re.Error(), prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// circuitBreaker guards the session operations of a RediStore.
+type circuitBreaker struct {
+	store *RediStore
+	opts  CircuitBreakerOptions
+	now   func() time.Time
+
+	mu        sync.Mutex
+	state     CircuitState
+	failures  int
+	successes int
+	openedAt  time.Time
+	probing   bool
+	changes   [][2]CircuitState // state changes not yet passed to OnStateChange
+}
+
+// unlock releases the lock, then reports the state changes made while it
+// was held.
+func (b *circuitBreaker) unlock() {
+	changes := b.changes
+	b.changes = nil
+	b.mu.Unlock()
+	if b.opts.OnStateChange == nil {
+		return
+	}
+	for _, c := range changes {
+		b.opts.OnStateChange(c[0], c[1])
+	}
+}
+
+// stateLocked returns the current state, moving from open to half-open once
+// the cooldown has passed.
+func (b *circuitBreaker) stateLocked() CircuitState {
+	if b.state == CircuitOpen && b.now().Sub(b.openedAt) >= b.opts.Cooldown {
+		b.setStateLocked(CircuitHalfOpen)
+	}
+	return b.state
+}
+
+func (b *circuitBreaker) setStateLocked(to CircuitState) {
+	from := b.state
+	b.state = to
+	switch to {
+	case CircuitOpen:
+		b.openedAt = b.now()
+	case CircuitClosed:
+		b.failures = 0
+	case CircuitHalfOpen:
+		b.successes = 0
+	}
+	if from != to {
+		b.changes = append(b.changes, [2]CircuitState{from, to})
+	}
+}
+
+// allow reports whether an operation may go to Redis. Operations allowed
+// must report their outcome with done.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.unlock()
+	switch b.stateLocked() {
+	case CircuitClosed:
+		return true
+	case CircuitHalfOpen:
+		if !b.probing {
+			b.probing = true
+			return true
+		}
+	}
+	return false
+}
+
+// done records the outcome of an operation allowed by allow.
+func (b *circuitBreaker) done(err error) {
+	failed := err != nil && b.opts.IsFailure(err)
+	b.mu.Lock()
+	defer b.unlock()
+	switch b.state {
+	case CircuitClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.opts.Threshold {
+			b.setStateLocked(CircuitOpen)
+		}
+	case CircuitHalfOpen:
+		b.probing = false
+		if failed {
+			b.setStateLocked(CircuitOpen)
+			return
+		}
+		b.successes++
+		if b.successes >= b.opts.Probes {
+			b.setStateLocked(CircuitClosed)
+		}
+	}
+}
+
+// loadsWrite reports whether loads may write the bookkeeping of the sessions
+// they load, which they do not in FallbackReadOnly mode while the circuit is
+// not closed. It is true without a breaker.
+func (b *circuitBreaker) loadsWrite() bool {
+	return b == nil || b.opts.Fallback != FallbackReadOnly || b.closed()
+}
+
+// closed reports whether the circuit is closed.
+func (b *circuitBreaker) closed() bool {
+	b.mu.Lock()
+	defer b.unlock()
+	return b.stateLocked() == CircuitClosed
+}
+
+func (b *circuitBreaker) newSession(r *http.Request, name string) (*sessions.Session, error) {
+	if b.opts.Fallback == FallbackReadOnly {
+		session, err := b.store.newSession(r, name)
+		if err != nil && !b.closed() && b.opts.IsFailure(err) {
+			return b.freshSession(name), nil
+		}
+		return session, err
+	}
+	if !b.allow() {
+		return b.fallbackSession(r, name), nil
+	}
+	session, err := b.store.newSession(r, name)
+	b.done(err)
+	if err != nil && session.ID == "" && b.opts.Fallback == FallbackCookie {
+		// The cookie may have been written by the fallback during an outage.
+		if fs := b.fallbackSession(r, name); !fs.IsNew {
+			return fs, nil
+		}
+	}
+	return session, err
+}
+
+func (b *circuitBreaker) saveSession(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if !b.allow() {
+		return b.fallbackSave(r, w, session.Name(), session.Values, session.Options)
+	}
+	err := b.store.saveSession(r, w, session)
+	b.done(err)
+	return err
+}
+
+func (b *circuitBreaker) deleteSession(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if !b.allow() {
+		options := *session.Options
+		options.MaxAge = -1
+		err := b.fallbackSave(r, w, session.Name(), session.Values, &options)
+		for k := range session.Values {
+			delete(session.Values, k)
+		}
+		return err
+	}
+	err := b.store.deleteSession(r, w, session)
+	b.done(err)
+	return err
+}
+
+// freshSession returns a new, empty session of the store.
+func (b *circuitBreaker) freshSession(name string) *sessions.Session {
+	session := sessions.NewSession(b.store, name)
+	options := *b.store.Options
+	session.Options = &options
+	session.IsNew = true
+	return session
+}
+
+// fallbackSession returns a session of the store for a request while the
+// circuit is open. With FallbackCookie it carries the values of the
+// fallback store's session, if the request has one, and is not new.
+func (b *circuitBreaker) fallbackSession(r *http.Request, name string) *sessions.Session {
+	session := b.freshSession(name)
+	if b.opts.Fallback != FallbackCookie {
+		return session
+	}
+	fs, err := b.opts.Store.New(r, name)
+	if err != nil || fs.IsNew {
+		return session
+	}
+	for k, v := range fs.Values {
+		session.Values[k] = v
+	}
+	session.IsNew = false
+	return session
+}
+
+// fallbackSave saves the session while the circuit is open. Only
+// FallbackCookie saves anything, to the fallback store.
+func (b *circuitBreaker) fallbackSave(r *http.Request, w http.ResponseWriter, name string, values map[interface{}]interface{}, options *sessions.Options) error {
+	if b.opts.Fallback != FallbackCookie {
+		return nil
+	}
+	fs := sessions.NewSession(b.opts.Store, name)
+	fs.Values = values
+	fs.Options = options
+	return b.opts.Store.Save(r, w, fs)
+}
@@ -0,0 +1,357 @@
+package redistore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/redis/go-redis/v9"
+)
+
+// outageHook fails the commands it is told to with a connection refused
+// error, as if Redis were down, or with the error the down func sets.
+type outageHook struct {
+	mu   sync.Mutex
+	down func(cmd redis.Cmder) bool
+}
+
+func (h *outageHook) set(down func(cmd redis.Cmder) bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.down = down
+}
+
+func (h *outageHook) failing(cmds ...redis.Cmder) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, cmd := range cmds {
+		if h.down != nil && h.down(cmd) {
+			return true
+		}
+	}
+	return false
+}
+
+var errRefused = &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+
+func (h *outageHook) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (h *outageHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if h.failing(cmd) {
+			err := cmd.Err()
+			if err == nil {
+				err = errRefused
+			}
+			cmd.SetErr(err)
+			return err
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h *outageHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if h.failing(cmds...) {
+			var err error = errRefused
+			for _, cmd := range cmds {
+				if cmd.Err() != nil {
+					err = cmd.Err()
+				}
+			}
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		return next(ctx, cmds)
+	}
+}
+
+func all(redis.Cmder) bool { return true }
+
+// breakerStore returns a store with an outage hook and a controllable clock
+// for its circuit breaker.
+func breakerStore(t *testing.T, opts *CircuitBreakerOptions) (*RediStore, *outageHook, func(time.Duration)) {
+	t.Helper()
+	store, err := NewRediStore([]string{setup()}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	})
+	store.SetKeyPrefix("breaker_test_")
+	t.Cleanup(func() { purgeSessions(t, store) })
+	hook := &outageHook{}
+	store.Client.AddHook(hook)
+	t.Cleanup(func() { hook.set(nil) })
+	if err := store.SetCircuitBreaker(opts); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	var mu sync.Mutex
+	store.breaker.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+	return store, hook, advance
+}
+
+// saveValues saves a new session with the given values and returns a
+// request carrying its cookie, if one was set.
+func saveValues(t *testing.T, store *RediStore, values map[interface{}]interface{}) (*http.Request, error) {
+	t.Helper()
+	session, err := store.New(httptest.NewRequest("GET", "http://localhost/", nil), "session-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range values {
+		session.Values[k] = v
+	}
+	rsp := httptest.NewRecorder()
+	err = store.Save(nil, rsp, session)
+	req := httptest.NewRequest("GET", "http://localhost/", nil)
+	for _, c := range rsp.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	return req, err
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var changes []string
+	store, hook, advance := breakerStore(t, &CircuitBreakerOptions{
+		Threshold: 2,
+		Cooldown:  time.Minute,
+		OnStateChange: func(from, to CircuitState) {
+			changes = append(changes, from.String()+">"+to.String())
+		},
+	})
+	req, err := saveValues(t, store, map[interface{}]interface{}{"user_id": 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Errors are returned until the circuit opens.
+	hook.set(all)
+	for i := 0; i < 2; i++ {
+		if _, err := store.New(req, "session-key"); !errors.Is(err, syscall.ECONNREFUSED) {
+			t.Errorf("Expected connection refused; Got %v", err)
+		}
+	}
+	if s := store.CircuitState(); s != CircuitOpen {
+		t.Fatalf("Expected the circuit to be open; Got %v", s)
+	}
+
+	// While open, sessions are anonymous and saves are dropped.
+	session, err := store.New(req, "session-key")
+	if err != nil || !session.IsNew || len(session.Values) != 0 {
+		t.Errorf("Expected a fresh session; Got %v, %v, %v", session.IsNew, session.Values, err)
+	}
+	session.Values["dropped"] = true
+	rsp := httptest.NewRecorder()
+	if err := store.Save(req, rsp, session); err != nil || rsp.Header().Get("Set-Cookie") != "" {
+		t.Errorf("Expected the save to be dropped; Got %v, %q", err, rsp.Header().Get("Set-Cookie"))
+	}
+
+	// A failed probe opens the circuit again.
+	advance(time.Minute)
+	if s := store.CircuitState(); s != CircuitHalfOpen {
+		t.Errorf("Expected the circuit to be half-open; Got %v", s)
+	}
+	if _, err := store.New(req, "session-key"); err == nil {
+		t.Error("Expected the probe to fail")
+	}
+	if s := store.CircuitState(); s != CircuitOpen {
+		t.Errorf("Expected the circuit to be open; Got %v", s)
+	}
+
+	// A successful probe closes it.
+	hook.set(nil)
+	advance(time.Minute)
+	session, err = store.New(req, "session-key")
+	if err != nil || session.IsNew || session.Values["user_id"] != 42 {
+		t.Errorf("Expected the saved session; Got %v, %v, %v", session.IsNew, session.Values, err)
+	}
+	if s := store.CircuitState(); s != CircuitClosed {
+		t.Errorf("Expected the circuit to be closed; Got %v", s)
+	}
+	want := []string{"closed>open", "open>half-open", "half-open>open", "open>half-open", "half-open>closed"}
+	if len(changes) != len(want) {
+		t.Fatalf("Expected changes %v; Got %v", want, changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("Expected changes %v; Got %v", want, changes)
+			break
+		}
+	}
+
+	// Errors that are not backend failures do not count.
+	store.SetMaxLength(8)
+	for i := 0; i < 3; i++ {
+		if _, err := saveValues(t, store, map[interface{}]interface{}{"big": "0123456789"}); err == nil {
+			t.Error("Expected a too big error")
+		}
+	}
+	if s := store.CircuitState(); s != CircuitClosed {
+		t.Errorf("Expected the circuit to stay closed; Got %v", s)
+	}
+}
+
+func TestCircuitBreakerCookieFallback(t *testing.T) {
+	if err := (&RediStore{}).SetCircuitBreaker(&CircuitBreakerOptions{Fallback: FallbackCookie}); err == nil {
+		t.Error("Expected an error for FallbackCookie without a Store")
+	}
+	cookies := sessions.NewCookieStore([]byte("secret-key"))
+	store, hook, advance := breakerStore(t, &CircuitBreakerOptions{
+		Threshold: 1,
+		Cooldown:  time.Minute,
+		Fallback:  FallbackCookie,
+		Store:     cookies,
+	})
+
+	hook.set(all)
+	if _, err := saveValues(t, store, map[interface{}]interface{}{"n": 1}); err == nil {
+		t.Fatal("Expected the first save to fail")
+	}
+
+	// While open, sessions live in fallback cookies.
+	req, err := saveValues(t, store, map[interface{}]interface{}{"n": 2})
+	if err != nil || len(req.Cookies()) != 1 {
+		t.Fatalf("Expected a fallback cookie; Got %v, %v", req.Cookies(), err)
+	}
+	session, err := store.New(req, "session-key")
+	if err != nil || session.IsNew || session.Values["n"] != 2 {
+		t.Errorf("Expected the fallback session; Got %v, %v, %v", session.IsNew, session.Values, err)
+	}
+
+	// Once Redis is back, the fallback session moves into Redis.
+	hook.set(nil)
+	advance(time.Minute)
+	session, err = store.New(req, "session-key")
+	if err != nil || session.ID != "" || session.Values["n"] != 2 {
+		t.Fatalf("Expected the fallback values; Got %q, %v, %v", session.ID, session.Values, err)
+	}
+	rsp := httptest.NewRecorder()
+	if err := store.Save(req, rsp, session); err != nil || session.ID == "" {
+		t.Fatalf("Expected the session to be saved to Redis; Got %q, %v", session.ID, err)
+	}
+	req = httptest.NewRequest("GET", "http://localhost/", nil)
+	req.AddCookie(rsp.Result().Cookies()[0])
+	session, err = store.New(req, "session-key")
+	if err != nil || session.IsNew || session.Values["n"] != 2 {
+		t.Errorf("Expected the Redis session; Got %v, %v, %v", session.IsNew, session.Values, err)
+	}
+}
+
+func TestCircuitBreakerReadOnly(t *testing.T) {
+	store, hook, _ := breakerStore(t, &CircuitBreakerOptions{
+		Threshold: 1,
+		Cooldown:  time.Minute,
+		Fallback:  FallbackReadOnly,
+	})
+	req, err := saveValues(t, store, map[interface{}]interface{}{"user_id": 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Failing writes open the circuit; reads keep working.
+	hook.set(func(cmd redis.Cmder) bool { return cmd.Name() != "get" })
+	if _, err := saveValues(t, store, map[interface{}]interface{}{"n": 1}); err == nil {
+		t.Fatal("Expected the save to fail")
+	}
+	if s := store.CircuitState(); s != CircuitOpen {
+		t.Fatalf("Expected the circuit to be open; Got %v", s)
+	}
+	session, err := store.New(req, "session-key")
+	if err != nil || session.Values["user_id"] != 42 {
+		t.Errorf("Expected the saved session; Got %v, %v", session.Values, err)
+	}
+	session.Values["user_id"] = 7
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Errorf("Expected the save to be dropped; Got %v", err)
+	}
+
+	// Failing reads give a fresh session while the circuit is open.
+	hook.set(all)
+	session, err = store.New(req, "session-key")
+	if err != nil || !session.IsNew {
+		t.Errorf("Expected a fresh session; Got %v, %v", session.IsNew, err)
+	}
+}
+
+func TestCircuitBreakerReadOnlyMetadata(t *testing.T) {
+	store, hook, _ := breakerStore(t, &CircuitBreakerOptions{
+		Threshold: 1,
+		Cooldown:  time.Minute,
+		Fallback:  FallbackReadOnly,
+	})
+	store.SetSessionMetadata(true)
+	req, err := saveValues(t, store, map[interface{}]interface{}{"user_id": 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes fail as on a replica not yet promoted, opening the circuit.
+	var writes atomic.Int32
+	hook.set(func(cmd redis.Cmder) bool {
+		if cmd.Name() == "get" {
+			return false
+		}
+		writes.Add(1)
+		cmd.SetErr(readOnlyError{})
+		return true
+	})
+	if _, err := saveValues(t, store, map[interface{}]interface{}{"n": 1}); err == nil {
+		t.Fatal("Expected the save to fail")
+	}
+	if s := store.CircuitState(); s != CircuitOpen {
+		t.Fatalf("Expected the circuit to be open; Got %v", s)
+	}
+
+	// Loads neither lose the session nor try to update its metadata.
+	writes.Store(0)
+	session, err := store.New(req, "session-key")
+	if err != nil || session.IsNew || session.Values["user_id"] != 42 {
+		t.Errorf("Expected the saved session; Got %v, %v", session.Values, err)
+	}
+	if n := writes.Load(); n != 0 {
+		t.Errorf("Expected no writes; Got %d", n)
+	}
+}
+
+func TestIsTransientError(t *testing.T) {
+	for err, want := range map[error]bool{
+		nil:                      false,
+		redis.Nil:                false,
+		context.Canceled:         false,
+		errors.New("gob: bad"):   false,
+		context.DeadlineExceeded: true,
+		errRefused:               true,
+		redis.ErrClosed:          true,
+		redis.ErrPoolTimeout:     true,
+	} {
+		if got := IsTransientError(err); got != want {
+			t.Errorf("IsTransientError(%v): Expected %v; Got %v", err, want, got)
+		}
+	}
+}
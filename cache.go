@@ -0,0 +1,282 @@
+package redistore
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// CacheOptions configures the in-process session cache.
+//
+// Fields:
+//
+//	MaxEntries: Maximum number of cached sessions. Defaults to 10000.
+//	MaxBytes: Maximum total size of the cached payloads. Defaults to 32 MiB.
+//	TTL: How long a session is served from the cache before it is read
+//	  again. It bounds how stale a session can be when Redis changes it
+//	  without an invalidation, as when it expires. Defaults to 5 seconds.
+//	Channel: The pub/sub channel invalidations are published on. Stores
+//	  sharing sessions must use the same channel. Defaults to the key prefix
+//	  followed by "invalidate".
+type CacheOptions struct {
+	MaxEntries int
+	MaxBytes   int
+	TTL        time.Duration
+	Channel    string
+}
+
+// cacheHealthCheck is how long the invalidation subscription may be silent
+// before it is pinged.
+const cacheHealthCheck = 30 * time.Second
+
+// cacheRetryDelay is the delay before receiving again after the invalidation
+// subscription failed.
+const cacheRetryDelay = time.Second
+
+// SetCache enables an in-process cache of session payloads, so repeated
+// loads of an unchanged session do not go to Redis. Every store with a cache
+// publishes the ID of each session it saves or deletes on a pub/sub channel
+// and drops the sessions published by the others, so sessions stay
+// consistent across processes. Cached payloads are deserialized on every
+// load, so sessions never share their Values.
+//
+// The cache is only used while the invalidation subscription is up; it is
+// emptied whenever the subscription is lost. Changes made to sessions other
+// than through a store with a cache, e.g. by a script or by another tool,
+// are seen once the cached session's TTL passes.
+//
+// SetCache must be called after SetKeyPrefix. A nil opts disables the cache,
+// returning any error closing its subscription. Close stops the subscription.
+func (s *RediStore) SetCache(opts *CacheOptions) error {
+	if s.cache != nil {
+		err := s.cache.close()
+		s.cache = nil
+		if err != nil {
+			return err
+		}
+	}
+	if opts == nil {
+		return nil
+	}
+	o := *opts
+	if o.MaxEntries <= 0 {
+		o.MaxEntries = 10000
+	}
+	if o.MaxBytes <= 0 {
+		o.MaxBytes = 32 << 20
+	}
+	if o.TTL <= 0 {
+		o.TTL = 5 * time.Second
+	}
+	if o.Channel == "" {
+		o.Channel = s.keyPrefix + "invalidate"
+	}
+	ctx := context.Background()
+	ps := s.Client.Subscribe(ctx)
+	// Receive the confirmation here, so an unsupported pub/sub is reported.
+	// The error of the subscription matters more than closing it.
+	if err := ps.Subscribe(ctx, o.Channel); err != nil {
+		_ = ps.Close()
+		return err
+	}
+	msg, err := ps.Receive(ctx)
+	if err != nil {
+		_ = ps.Close()
+		return err
+	}
+	if _, ok := msg.(*redis.Subscription); !ok {
+		_ = ps.Close()
+		return fmt.Errorf("redistore: unexpected pub/sub message %v", msg)
+	}
+	c := &sessionCache{
+		opts:    o,
+		now:     time.Now,
+		pubsub:  ps,
+		done:    make(chan struct{}),
+		live:    true,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+	c.wg.Add(1)
+	go c.receive()
+	s.cache = c
+	return nil
+}
+
+// invalidate drops the sessions with the given IDs from the caches of every
+// store sharing the channel, or every session for the ID "*", and keeps
+// later loads from joining reads in flight. Publishing is best effort: if it
+// fails, other caches serve the session until its TTL passes.
+func (s *RediStore) invalidate(ctx context.Context, ids ...string) {
+	for _, id := range ids {
+		s.loads.forget(id)
+	}
+	if s.cache == nil {
+		return
+	}
+	for _, id := range ids {
+		s.cache.invalidate(id)
+		s.Client.Publish(ctx, s.cache.opts.Channel, id)
+	}
+}
+
+// sessionCache is an LRU cache of session payloads kept consistent through
+// pub/sub invalidations. Its methods are no-ops on a nil cache.
+type sessionCache struct {
+	opts   CacheOptions
+	now    func() time.Time
+	pubsub *redis.PubSub
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	live    bool   // whether the subscription is up
+	epoch   uint64 // incremented by every invalidation
+	entries map[string]*list.Element
+	lru     *list.List // of *cacheEntry, most recently used first
+	size    int        // total payload size
+}
+
+// cacheEntry is a cached session payload.
+type cacheEntry struct {
+	id      string
+	data    string
+	expires time.Time
+}
+
+// get returns the cached payload of a session.
+func (c *sessionCache) get(id string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[id]
+	if !ok || !c.live {
+		return "", false
+	}
+	e := el.Value.(*cacheEntry)
+	if !c.now().Before(e.expires) {
+		c.removeLocked(el)
+		return "", false
+	}
+	c.lru.MoveToFront(el)
+	return e.data, true
+}
+
+// token returns the value to pass to put for a payload read from Redis now.
+func (c *sessionCache) token() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.epoch
+}
+
+// put caches the payload of a session read from Redis after token was
+// taken. It is dropped if an invalidation arrived meanwhile, as the payload
+// may predate it.
+func (c *sessionCache) put(id, data string, token uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.live || c.epoch != token || len(data) > c.opts.MaxBytes {
+		return
+	}
+	if el, ok := c.entries[id]; ok {
+		c.removeLocked(el)
+	}
+	c.entries[id] = c.lru.PushFront(&cacheEntry{id: id, data: data, expires: c.now().Add(c.opts.TTL)})
+	c.size += len(data)
+	for c.lru.Len() > c.opts.MaxEntries || c.size > c.opts.MaxBytes {
+		c.removeLocked(c.lru.Back())
+	}
+}
+
+// invalidate drops a session, or every session for the ID "*".
+func (c *sessionCache) invalidate(id string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.epoch++
+	if id == "*" {
+		c.clearLocked()
+	} else if el, ok := c.entries[id]; ok {
+		c.removeLocked(el)
+	}
+}
+
+// setLive empties the cache and sets whether the subscription is up.
+func (c *sessionCache) setLive(live bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.epoch++
+	c.live = live
+	c.clearLocked()
+}
+
+func (c *sessionCache) removeLocked(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, e.id)
+	c.size -= len(e.data)
+}
+
+func (c *sessionCache) clearLocked() {
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.size = 0
+}
+
+// receive applies invalidations until the cache is closed. go-redis
+// resubscribes after reconnecting, and the confirmation marks the
+// subscription up again.
+func (c *sessionCache) receive() {
+	defer c.wg.Done()
+	ctx := context.Background()
+	for {
+		msg, err := c.pubsub.ReceiveTimeout(ctx, cacheHealthCheck)
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() && c.pubsub.Ping(ctx) == nil {
+				continue
+			}
+			c.setLive(false)
+			select {
+			case <-c.done:
+				return
+			case <-time.After(cacheRetryDelay):
+			}
+			continue
+		}
+		switch m := msg.(type) {
+		case *redis.Subscription:
+			c.setLive(true)
+		case *redis.Message:
+			c.invalidate(m.Payload)
+		}
+	}
+}
+
+// close stops the subscription.
+func (c *sessionCache) close() error {
+	close(c.done)
+	err := c.pubsub.Close()
+	c.wg.Wait()
+	return err
+}
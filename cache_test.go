@@ -0,0 +1,176 @@
+package redistore
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cacheStore returns a store with a session cache on the Redis server at
+// url, sharing its sessions and invalidations with the other stores of the
+// test on that server.
+func cacheStore(t *testing.T, url string, opts *CacheOptions) *RediStore {
+	t.Helper()
+	store, err := NewRediStore([]string{url}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	})
+	store.SetKeyPrefix("cache_test_")
+	if err := store.SetCache(opts); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// eventually fails the test unless cond holds within a second.
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Condition not met within a second")
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	url := startServer(t)
+	a := cacheStore(t, url, &CacheOptions{})
+	b := cacheStore(t, url, &CacheOptions{})
+	defer purgeSessions(t, a)
+
+	req, err := saveValues(t, a, map[interface{}]interface{}{"n": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	load := func(s *RediStore) interface{} {
+		session, err := s.New(req, "session-key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return session.Values["n"]
+	}
+	if n := load(b); n != 1 {
+		t.Fatalf("Expected 1; Got %v", n)
+	}
+	session, err := b.New(req, "session-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := session.ID
+
+	// Loads of an unchanged session are served from the cache, each with
+	// its own values.
+	if err := b.Client.Del(ctx, "cache_test_"+id).Err(); err != nil {
+		t.Fatal(err)
+	}
+	session.Values["n"] = 2
+	if n := load(b); n != 1 {
+		t.Errorf("Expected the cached 1; Got %v", n)
+	}
+
+	// Saves by another store invalidate the cache.
+	session.Options.MaxAge = 60
+	if err := a.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool { return load(b) == 2 })
+
+	// So do deletes.
+	if err := a.DestroySession(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool { return load(b) == nil })
+
+	// Disabling the cache stops its subscription.
+	if err := b.SetCache(nil); err != nil || b.cache != nil {
+		t.Errorf("Expected no cache; Got %v", err)
+	}
+}
+
+func TestCacheInvalidateAll(t *testing.T) {
+	ctx := context.Background()
+	url := startServer(t)
+	a := cacheStore(t, url, &CacheOptions{})
+	b := cacheStore(t, url, &CacheOptions{})
+	defer purgeSessions(t, a)
+	a.SetRevocationEpochs(true)
+	b.SetRevocationEpochs(true)
+	defer a.Client.Del(ctx, a.epochKey())
+
+	req, err := saveValues(t, a, map[interface{}]interface{}{"n": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session, err := b.New(req, "session-key"); err != nil || session.IsNew {
+		t.Fatalf("Expected the saved session; Got %v", err)
+	}
+	if err := a.RevokeSessions(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool {
+		session, err := b.New(req, "session-key")
+		return err == nil && session.IsNew
+	})
+}
+
+func TestSessionCache(t *testing.T) {
+	c := &sessionCache{
+		opts:    CacheOptions{MaxEntries: 2, MaxBytes: 10, TTL: time.Second},
+		live:    true,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	// Entries are evicted least recently used first.
+	c.put("a", "1", c.token())
+	c.put("b", "2", c.token())
+	c.get("a")
+	c.put("c", "3", c.token())
+	if _, ok := c.get("b"); ok || len(c.entries) != 2 {
+		t.Errorf("Expected b to be evicted; Got %v", c.entries)
+	}
+
+	// So are entries over the size limit.
+	c.put("d", "0123456789", c.token())
+	if _, ok := c.get("a"); ok || c.size != 10 {
+		t.Errorf("Expected a and c to be evicted; Got %d bytes", c.size)
+	}
+	c.put("e", strings.Repeat("x", 11), c.token())
+	if _, ok := c.get("e"); ok {
+		t.Error("Expected e to be too big to cache")
+	}
+
+	// Payloads read before an invalidation are not cached.
+	token := c.token()
+	c.invalidate("f")
+	c.put("f", "6", token)
+	if _, ok := c.get("f"); ok {
+		t.Error("Expected f not to be cached")
+	}
+
+	// Entries expire with their TTL.
+	now = now.Add(time.Second)
+	if _, ok := c.get("d"); ok {
+		t.Error("Expected d to have expired")
+	}
+
+	// Nothing is served while the subscription is down.
+	c.put("g", "7", c.token())
+	c.setLive(false)
+	c.put("g", "7", c.token())
+	if _, ok := c.get("g"); ok {
+		t.Error("Expected g not to be served")
+	}
+}
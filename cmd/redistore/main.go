@@ -0,0 +1,397 @@
+/*
+Command redistore administers the sessions held by a redistore.RediStore.
+
+Usage:
+
+	redistore [flags] <command> [arguments]
+
+The flags select the store and must come before the command:
+
+	-url URL        Redis URL as accepted by redistore.NewRediStore. Repeat
+	                for multiple cluster nodes. Defaults to $REDIS_URL, then
+	                redis://localhost:6379.
+	-tls            Connect using TLS.
+	-prefix STRING  Key prefix of the store. Defaults to "session_".
+	-serializer S   Session serializer, "gob" (default) or "json".
+
+The commands are:
+
+	list [-limit N] [-prefix ID] [-user USER]  list sessions
+	show ID                                    show a session's TTL, metadata and values
+	ttl ID                                     show a session's remaining TTL
+	extend ID DURATION                         set a session's remaining TTL, e.g. 24h
+	delete ID                                  delete a session
+	delete-by-user USER                        delete every session of a user
+	stats                                      count the sessions in the store
+	purge -force                               delete every session in the store
+	export [-decode] [-o FILE]                 write every session as JSON Lines
+	import [-dry-run] [-i FILE]                read sessions written by export
+
+All output is JSON. Export writes its JSON Lines to standard output unless -o
+is given, and import reads standard input unless -i is given; both report
+progress on standard error. Listing and deleting by user only work if the application
+enables the store's user index with RediStore.SetUserIDFunc.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/poseidonphp/redistore"
+)
+
+// urlList collects the values of a repeated -url flag.
+type urlList []string
+
+func (u *urlList) String() string {
+	return strings.Join(*u, ",")
+}
+
+func (u *urlList) Set(v string) error {
+	*u = append(*u, v)
+	return nil
+}
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], stdio{os.Stdin, os.Stdout, os.Stderr}); err != nil {
+		fmt.Fprintln(os.Stderr, "redistore:", err)
+		os.Exit(1)
+	}
+}
+
+// stdio holds the standard streams of the tool.
+type stdio struct {
+	in       io.Reader
+	out, err io.Writer
+}
+
+// run executes the command line in args, writing results to std.out.
+func run(ctx context.Context, args []string, std stdio) (err error) {
+	var urls urlList
+	fs := flag.NewFlagSet("redistore", flag.ContinueOnError)
+	fs.SetOutput(std.err)
+	fs.Var(&urls, "url", "Redis URL, repeatable")
+	useTLS := fs.Bool("tls", false, "connect using TLS")
+	prefix := fs.String("prefix", "session_", "key prefix of the store")
+	serializer := fs.String("serializer", "gob", `session serializer, "gob" or "json"`)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("missing command")
+	}
+	if len(urls) == 0 {
+		if env := os.Getenv("REDIS_URL"); env != "" {
+			urls = append(urls, env)
+		} else {
+			urls = append(urls, "redis://localhost:6379")
+		}
+	}
+
+	store, err := redistore.NewRediStore(urls, *useTLS)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := store.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+	store.SetKeyPrefix(*prefix)
+	switch *serializer {
+	case "gob":
+		store.SetSerializer(redistore.GobSerializer{})
+	case "json":
+		store.SetSerializer(redistore.JSONSerializer{})
+	default:
+		return fmt.Errorf("unknown serializer %q", *serializer)
+	}
+
+	cmd, cmdArgs := fs.Arg(0), fs.Args()[1:]
+	c, ok := commands[cmd]
+	if !ok {
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+	out, err := c(ctx, store, cmdArgs, std)
+	if err != nil || out == nil {
+		return err
+	}
+	enc := json.NewEncoder(std.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// command runs a subcommand and returns the value to print, if any.
+type command func(ctx context.Context, store *redistore.RediStore, args []string, std stdio) (interface{}, error)
+
+var commands = map[string]command{
+	"list":           list,
+	"show":           show,
+	"ttl":            ttl,
+	"extend":         extend,
+	"delete":         remove,
+	"delete-by-user": removeByUser,
+	"stats":          stats,
+	"purge":          purge,
+	"export":         export,
+	"import":         importSessions,
+}
+
+// session is the JSON representation of a session.
+type session struct {
+	ID         string                 `json:"id"`
+	TTLSeconds int64                  `json:"ttl_seconds"`
+	Metadata   *redistore.Metadata    `json:"metadata,omitempty"`
+	Values     map[string]interface{} `json:"values,omitempty"`
+}
+
+func summary(rec *redistore.SessionRecord) session {
+	return session{ID: rec.ID, TTLSeconds: int64(rec.TTL / time.Second), Metadata: rec.Metadata}
+}
+
+// exactArgs returns an error unless args holds n values.
+func exactArgs(name string, args []string, n int, usage string) error {
+	if len(args) != n {
+		return fmt.Errorf("usage: %s %s", name, usage)
+	}
+	return nil
+}
+
+func list(ctx context.Context, store *redistore.RediStore, args []string, std stdio) (interface{}, error) {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	fs.SetOutput(std.err)
+	limit := fs.Int("limit", 100, "maximum number of sessions, 0 for all")
+	prefix := fs.String("prefix", "", "only list session IDs starting with this")
+	user := fs.String("user", "", "only list the sessions of this user")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	out := []session{}
+	if *user != "" {
+		recs, err := store.UserSessionRecordsRaw(ctx, *user)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range recs {
+			if *limit > 0 && len(out) == *limit {
+				break
+			}
+			out = append(out, summary(rec))
+		}
+		return out, nil
+	}
+	opts := redistore.ScanOptions{Load: true, Raw: true, IDPrefix: *prefix}
+	err := store.Scan(ctx, opts, func(rec *redistore.SessionRecord) error {
+		out = append(out, summary(rec))
+		if *limit > 0 && len(out) == *limit {
+			return redistore.ErrStopScan
+		}
+		return nil
+	})
+	return out, err
+}
+
+func show(ctx context.Context, store *redistore.RediStore, args []string, _ stdio) (interface{}, error) {
+	if err := exactArgs("show", args, 1, "ID"); err != nil {
+		return nil, err
+	}
+	rec, err := store.LookupSession(ctx, args[0])
+	if err != nil {
+		return nil, err
+	}
+	out := summary(rec)
+	out.Values = make(map[string]interface{}, len(rec.Values))
+	for k, v := range rec.Values {
+		if _, err := json.Marshal(v); err != nil {
+			v = fmt.Sprintf("%v", v)
+		}
+		out.Values[fmt.Sprint(k)] = v
+	}
+	return out, nil
+}
+
+func ttl(ctx context.Context, store *redistore.RediStore, args []string, _ stdio) (interface{}, error) {
+	if err := exactArgs("ttl", args, 1, "ID"); err != nil {
+		return nil, err
+	}
+	d, err := store.SessionTTL(ctx, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return session{ID: args[0], TTLSeconds: int64(d / time.Second)}, nil
+}
+
+func extend(ctx context.Context, store *redistore.RediStore, args []string, _ stdio) (interface{}, error) {
+	if err := exactArgs("extend", args, 2, "ID DURATION"); err != nil {
+		return nil, err
+	}
+	d, err := parseDuration(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if err := store.ExtendSession(ctx, args[0], d); err != nil {
+		return nil, err
+	}
+	return session{ID: args[0], TTLSeconds: int64(d / time.Second)}, nil
+}
+
+func remove(ctx context.Context, store *redistore.RediStore, args []string, _ stdio) (interface{}, error) {
+	if err := exactArgs("delete", args, 1, "ID"); err != nil {
+		return nil, err
+	}
+	if err := store.DestroySession(ctx, args[0]); err != nil {
+		return nil, err
+	}
+	return map[string]int{"deleted": 1}, nil
+}
+
+func removeByUser(ctx context.Context, store *redistore.RediStore, args []string, _ stdio) (interface{}, error) {
+	if err := exactArgs("delete-by-user", args, 1, "USER"); err != nil {
+		return nil, err
+	}
+	n, err := store.DestroyUserSessions(ctx, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int{"deleted": n}, nil
+}
+
+func stats(ctx context.Context, store *redistore.RediStore, args []string, _ stdio) (interface{}, error) {
+	if err := exactArgs("stats", args, 0, ""); err != nil {
+		return nil, err
+	}
+	var total, users int
+	err := store.Scan(ctx, redistore.ScanOptions{}, func(rec *redistore.SessionRecord) error {
+		total++
+		if strings.HasPrefix(rec.ID, "{") {
+			users++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int{"sessions": total, "user_sessions": users, "anonymous_sessions": total - users}, nil
+}
+
+func purge(ctx context.Context, store *redistore.RediStore, args []string, std stdio) (interface{}, error) {
+	fs := flag.NewFlagSet("purge", flag.ContinueOnError)
+	fs.SetOutput(std.err)
+	force := fs.Bool("force", false, "confirm deleting every session")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if !*force {
+		return nil, errors.New("purge deletes every session in the store, pass -force to confirm")
+	}
+	// Collect first so deleting does not disturb the SCAN cursor.
+	var ids []string
+	err := store.Scan(ctx, redistore.ScanOptions{}, func(rec *redistore.SessionRecord) error {
+		ids = append(ids, rec.ID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	n := 0
+	for _, id := range ids {
+		err := store.DestroySession(ctx, id)
+		if errors.Is(err, redistore.ErrSessionNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		n++
+	}
+	return map[string]int{"deleted": n}, nil
+}
+
+func export(ctx context.Context, store *redistore.RediStore, args []string, std stdio) (interface{}, error) {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(std.err)
+	decode := fs.Bool("decode", false, "export decoded values instead of raw payloads")
+	path := fs.String("o", "", "write to this file instead of standard output")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	w := std.out
+	var f *os.File
+	if *path != "" {
+		var err error
+		if f, err = os.Create(*path); err != nil {
+			return nil, err
+		}
+		w = f
+	}
+	n, err := store.Export(ctx, w, redistore.TransferOptions{Decode: *decode, Progress: progress(std.err, "exported")})
+	if f != nil {
+		// A file that failed to close may be truncated.
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if *path == "" {
+		// Standard output holds the export itself.
+		return nil, nil
+	}
+	return map[string]int{"exported": n}, nil
+}
+
+func importSessions(ctx context.Context, store *redistore.RediStore, args []string, std stdio) (interface{}, error) {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(std.err)
+	dryRun := fs.Bool("dry-run", false, "validate the input without writing anything")
+	path := fs.String("i", "", "read from this file instead of standard input")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	r := std.in
+	if *path != "" {
+		f, err := os.Open(*path)
+		if err != nil {
+			return nil, err
+		}
+		// Nothing was written, so a failure to close loses nothing.
+		defer func() { _ = f.Close() }()
+		r = f
+	}
+	n, err := store.Import(ctx, r, redistore.TransferOptions{DryRun: *dryRun, Progress: progress(std.err, "imported")})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"imported": n, "dry_run": *dryRun}, nil
+}
+
+// progress returns a TransferOptions.Progress callback reporting every
+// thousandth session on w.
+func progress(w io.Writer, verb string) func(int) {
+	return func(n int) {
+		if n%1000 == 0 {
+			fmt.Fprintf(w, "%s %d sessions\n", verb, n)
+		}
+	}
+}
+
+// parseDuration accepts a Go duration or a plain number of seconds.
+func parseDuration(v string) (time.Duration, error) {
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	return time.ParseDuration(v)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/poseidonphp/redistore"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultRedisURL = "redis://localhost:6379"
+	prefix          = "cli_test_"
+)
+
+func setup(t *testing.T) (string, *redistore.RediStore) {
+	addr := os.Getenv("REDIS_URL")
+	if addr == "" {
+		addr = defaultRedisURL
+	}
+	store, err := redistore.NewRediStore([]string{addr}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	store.SetKeyPrefix(prefix)
+	store.SetUserIDFunc(redistore.UserIDFromValue("user_id"))
+	return addr, store
+}
+
+func saveSession(t *testing.T, store *redistore.RediStore, uid string) string {
+	t.Helper()
+	req := httptest.NewRequest("GET", "http://localhost:8080/", nil)
+	session, _ := store.New(req, "session-key")
+	if uid != "" {
+		session.Values["user_id"] = uid
+	}
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	return session.ID
+}
+
+// cli runs the tool against addr and decodes its output into out.
+func cli(t *testing.T, addr string, out interface{}, args ...string) error {
+	t.Helper()
+	var stdout bytes.Buffer
+	args = append([]string{"-url", addr, "-prefix", prefix}, args...)
+	err := run(context.Background(), args, stdio{strings.NewReader(""), &stdout, io.Discard})
+	if err == nil && out != nil {
+		if jerr := json.Unmarshal(stdout.Bytes(), out); jerr != nil {
+			t.Fatalf("%v: invalid JSON %q: %v", args, stdout.String(), jerr)
+		}
+	}
+	return err
+}
+
+func TestCommands(t *testing.T) {
+	addr, store := setup(t)
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	defer cli(t, addr, nil, "purge", "-force")
+
+	anon := saveSession(t, store, "")
+	kim := saveSession(t, store, "kim")
+	broken := saveSession(t, store, "kim")
+	// Listing does not decode values, so an undecodable session is listed.
+	if err := store.Client.SetArgs(context.Background(), prefix+broken, "garbage", redis.SetArgs{KeepTTL: true}).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	var stats map[string]int
+	if err := cli(t, addr, &stats, "stats"); err != nil || stats["sessions"] != 3 || stats["user_sessions"] != 2 {
+		t.Errorf("Unexpected stats %v, %v", stats, err)
+	}
+
+	var list []session
+	if err := cli(t, addr, &list, "list", "-user", "kim"); err != nil || len(list) != 2 {
+		t.Errorf("Expected 2 sessions; Got %v, %v", list, err)
+	}
+	if err := cli(t, addr, &list, "list", "-limit", "1"); err != nil || len(list) != 1 {
+		t.Errorf("Expected 1 session; Got %v, %v", list, err)
+	}
+	if err := cli(t, addr, &list, "list", "-prefix", broken); err != nil || len(list) != 1 || list[0].ID != broken {
+		t.Errorf("Expected session %q; Got %v, %v", broken, list, err)
+	}
+
+	var shown session
+	if err := cli(t, addr, &shown, "show", kim); err != nil || shown.Values["user_id"] != "kim" {
+		t.Errorf("Unexpected session %+v, %v", shown, err)
+	}
+	if err := cli(t, addr, &shown, "extend", kim, "90s"); err != nil || shown.TTLSeconds != 90 {
+		t.Errorf("Unexpected extend result %+v, %v", shown, err)
+	}
+	if err := cli(t, addr, &shown, "ttl", kim); err != nil || shown.TTLSeconds > 90 || shown.TTLSeconds < 80 {
+		t.Errorf("Unexpected TTL %+v, %v", shown, err)
+	}
+
+	var deleted map[string]int
+	if err := cli(t, addr, &deleted, "delete", anon); err != nil || deleted["deleted"] != 1 {
+		t.Errorf("Unexpected delete result %v, %v", deleted, err)
+	}
+	if err := cli(t, addr, nil, "show", anon); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected not found; Got %v", err)
+	}
+	if err := cli(t, addr, &deleted, "delete-by-user", "kim"); err != nil || deleted["deleted"] != 2 {
+		t.Errorf("Unexpected delete-by-user result %v, %v", deleted, err)
+	}
+
+	saveSession(t, store, "")
+	if err := cli(t, addr, nil, "purge"); err == nil {
+		t.Error("Expected purge without -force to fail")
+	}
+	if err := cli(t, addr, &deleted, "purge", "-force"); err != nil || deleted["deleted"] != 1 {
+		t.Errorf("Unexpected purge result %v, %v", deleted, err)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	addr, store := setup(t)
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	for _, args := range [][]string{
+		{},
+		{"frobnicate"},
+		{"show"},
+		{"extend", "id"},
+		{"-serializer", "xml", "stats"},
+	} {
+		if err := cli(t, addr, nil, args...); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	addr, store := setup(t)
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	defer cli(t, addr, nil, "purge", "-force")
+	defer cli(t, addr, nil, "-prefix", "cli_import_test_", "purge", "-force")
+
+	id := saveSession(t, store, "")
+	path := t.TempDir() + "/sessions.jsonl"
+
+	var result map[string]interface{}
+	if err := cli(t, addr, &result, "export", "-o", path); err != nil || result["exported"] != float64(1) {
+		t.Fatalf("Unexpected export result %v, %v", result, err)
+	}
+	if _, err := os.Stat("/dev/full"); err == nil {
+		// An export that could not be written is not reported as done.
+		if err := cli(t, addr, nil, "export", "-o", "/dev/full"); err == nil {
+			t.Error("Expected the export to fail")
+		}
+	}
+	args := []string{"-prefix", "cli_import_test_", "import", "-i", path}
+	if err := cli(t, addr, &result, append(args, "-dry-run")...); err != nil || result["imported"] != float64(1) {
+		t.Fatalf("Unexpected dry run result %v, %v", result, err)
+	}
+	if err := cli(t, addr, nil, "-prefix", "cli_import_test_", "show", id); err == nil {
+		t.Fatal("Expected dry run not to import")
+	}
+	if err := cli(t, addr, &result, args...); err != nil || result["imported"] != float64(1) {
+		t.Fatalf("Unexpected import result %v, %v", result, err)
+	}
+	var shown session
+	if err := cli(t, addr, &shown, "-prefix", "cli_import_test_", "show", id); err != nil || shown.ID != id {
+		t.Errorf("Expected imported session %q; Got %+v, %v", id, shown, err)
+	}
+}
@@ -0,0 +1,59 @@
+package redistore
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// This file eases moving from github.com/boj/redistore, which this package
+// was forked from. Both libraries store a session as a gob encoded SETEX
+// under "session_" + ID and send the ID in a securecookie encoded cookie, so
+// with the same key pairs, key prefix and serializer a store created here
+// reads the sessions and cookies written by the original, and vice versa.
+
+// NewRediStoreWithDB creates a new RediStore connected to a single Redis
+// server with the arguments of the boj/redistore constructor of the same
+// name. Calls of boj/redistore's NewRediStore translate to this function
+// with an empty DB.
+//
+// Parameters:
+//
+//	size: The maximum number of idle connections kept open.
+//	network: "tcp" or "unix".
+//	address: The address of the Redis server, e.g. "localhost:6379".
+//	password: The password to authenticate with, if any.
+//	DB: The database number to select, if any.
+//	keyPairs: Key pairs for secure cookie encoding.
+//
+// Idle connections are closed after 240 seconds, as in boj/redistore. Other
+// defaults are those of NewRediStoreWithExistingClient.
+func NewRediStoreWithDB(size int, network, address, password, DB string, keyPairs ...[]byte) (*RediStore, error) {
+	opts := &redis.Options{
+		Network:         network,
+		Addr:            address,
+		Password:        password,
+		MaxIdleConns:    size,
+		ConnMaxIdleTime: 240 * time.Second,
+	}
+	if DB != "" {
+		db, err := strconv.Atoi(DB)
+		if err != nil {
+			return nil, fmt.Errorf("redistore: invalid DB %q: %w", DB, err)
+		}
+		opts.DB = db
+	}
+	return NewRediStoreWithExistingClient(redis.NewClient(opts), keyPairs...)
+}
+
+// NewRediStoreWithPool creates a new RediStore using the provided Redis
+// client, with the same defaults as boj/redistore's constructor of the same
+// name.
+//
+// Deprecated: The redigo pool is replaced by a go-redis client; use
+// NewRediStoreWithExistingClient.
+func NewRediStoreWithPool(client redis.UniversalClient, keyPairs ...[]byte) (*RediStore, error) {
+	return NewRediStoreWithExistingClient(client, keyPairs...)
+}
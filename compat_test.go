@@ -0,0 +1,157 @@
+package redistore
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/redis/go-redis/v9"
+)
+
+// bojFixture is a session saved by boj/redistore, see testdata/boj.
+type bojFixture struct {
+	Name        string `json:"name"`
+	Serializer  string `json:"serializer"`
+	HashKey     string `json:"hash_key"`
+	BlockKey    string `json:"block_key"`
+	SessionName string `json:"session_name"`
+	ID          string `json:"id"`
+	Key         string `json:"key"`
+	Record      string `json:"record"`
+	SetCookie   string `json:"set_cookie"`
+}
+
+func (f bojFixture) keyPairs() [][]byte {
+	pairs := [][]byte{[]byte(f.HashKey)}
+	if f.BlockKey != "" {
+		pairs = append(pairs, []byte(f.BlockKey))
+	}
+	return pairs
+}
+
+func loadBojFixtures(t *testing.T) []bojFixture {
+	t.Helper()
+	b, err := os.ReadFile("testdata/boj/fixtures.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fixtures []bojFixture
+	if err := json.Unmarshal(b, &fixtures); err != nil {
+		t.Fatal(err)
+	}
+	return fixtures
+}
+
+// newBojStore connects the way a boj/redistore deployment would.
+func newBojStore(t *testing.T, keyPairs ...[]byte) *RediStore {
+	t.Helper()
+	opts, err := redis.ParseURL(setup())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewRediStoreWithDB(10, "tcp", opts.Addr, opts.Password, "", keyPairs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	})
+	return store
+}
+
+func TestBojFixtures(t *testing.T) {
+	for _, f := range loadBojFixtures(t) {
+		t.Run(f.Name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newBojStore(t, f.keyPairs()...)
+			if f.Serializer == "json" {
+				store.SetSerializer(JSONSerializer{})
+			}
+			// The golden cookie carries the time it was issued; ignore its age.
+			for _, c := range store.Codecs {
+				c.(*securecookie.SecureCookie).MaxAge(0)
+			}
+
+			record, err := base64.StdEncoding.DecodeString(f.Record)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Client.Set(ctx, f.Key, record, time.Minute).Err(); err != nil {
+				t.Fatal(err)
+			}
+			defer store.Client.Del(ctx, f.Key)
+
+			req, _ := http.NewRequest("GET", "http://localhost/", nil)
+			req.Header.Add("Cookie", f.SetCookie)
+			session, err := store.Get(req, f.SessionName)
+			if err != nil {
+				t.Fatalf("Error getting session: %v", err)
+			}
+			if session.IsNew || session.ID != f.ID {
+				t.Fatalf("Expected session %s to load; Got ID %q, new %v", f.ID, session.ID, session.IsNew)
+			}
+			if v := session.Values["user"]; v != "gopher" {
+				t.Errorf("Expected user gopher; Got %v", v)
+			}
+			visits := session.Values["visits"]
+			if f.Serializer == "json" {
+				visits = int(visits.(float64))
+			}
+			if visits != 3 {
+				t.Errorf("Expected 3 visits; Got %v", session.Values["visits"])
+			}
+			if flashes := session.Flashes(); len(flashes) != 1 || flashes[0] != "welcome back" {
+				t.Errorf("Expected flash %q; Got %v", "welcome back", flashes)
+			}
+
+			// Saving keeps the key and cookie format boj/redistore reads.
+			session.Values["visits"] = 4
+			rsp := NewRecorder()
+			if err := store.Save(req, rsp, session); err != nil {
+				t.Fatalf("Error saving session: %v", err)
+			}
+			if session.ID != f.ID {
+				t.Errorf("Expected ID to be kept; Got %s", session.ID)
+			}
+			cookie := (&http.Response{Header: rsp.Header()}).Cookies()[0]
+			var id string
+			codecs := securecookie.CodecsFromPairs(f.keyPairs()...)
+			if err := securecookie.DecodeMulti(f.SessionName, cookie.Value, &id, codecs...); err != nil || id != f.ID {
+				t.Errorf("Expected cookie for %s; Got %q, %v", f.ID, id, err)
+			}
+			if cookie.Path != "/" || cookie.MaxAge != sessionExpire {
+				t.Errorf("Expected boj cookie options; Got path %q, max age %d", cookie.Path, cookie.MaxAge)
+			}
+			if ttl := store.Client.TTL(ctx, f.Key).Val(); ttl <= time.Minute {
+				t.Errorf("Expected record under %s to be rewritten; Got TTL %v", f.Key, ttl)
+			}
+		})
+	}
+}
+
+func TestNewRediStoreWithDB(t *testing.T) {
+	opts, err := redis.ParseURL(setup())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRediStoreWithDB(10, "tcp", opts.Addr, "", "one", []byte("secret-key")); err == nil {
+		t.Error("Expected an error for a non-numeric DB")
+	}
+
+	store := newBojStore(t, []byte("secret-key"))
+	if store.keyPrefix != "session_" || store.DefaultMaxAge != 60*20 || store.maxLength != 4096 {
+		t.Errorf("Expected boj defaults; Got prefix %q, default max age %d, max length %d",
+			store.keyPrefix, store.DefaultMaxAge, store.maxLength)
+	}
+	if _, ok := store.serializer.(GobSerializer); !ok {
+		t.Errorf("Expected GobSerializer; Got %T", store.serializer)
+	}
+}
@@ -0,0 +1,207 @@
+package redistore
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// ExpressCodec is a securecookie.Codec reading and writing the signed
+// session cookie of express-session, "s:" followed by the session ID, a dot
+// and its base64 HMAC-SHA256. Sessions shared with a Node.js application
+// using connect-redis are set up as
+//
+//	store.Codecs = []securecookie.Codec{redistore.NewExpressCodec("keyboard cat")}
+//	store.SetSerializer(redistore.ExpressSessionSerializer{})
+//	store.SetKeyPrefix("sess:")
+//
+// and used with the session name "connect.sid". express-session accepts an
+// array of secrets; a codec per secret, first one first, does the same.
+type ExpressCodec struct {
+	secret []byte
+}
+
+// NewExpressCodec returns an ExpressCodec signing with the given
+// express-session secret.
+func NewExpressCodec(secret string) *ExpressCodec {
+	return &ExpressCodec{secret: []byte(secret)}
+}
+
+// Encode signs the session ID in value as express-session does.
+func (c *ExpressCodec) Encode(_ string, value interface{}) (string, error) {
+	id, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("redistore: ExpressCodec encodes session ID strings, not %T", value)
+	}
+	// express-session URI encodes cookie values.
+	return url.QueryEscape("s:" + id + "." + c.sign(id)), nil
+}
+
+// Decode verifies a signed express-session cookie and stores its session ID
+// into dst, which must be a *string.
+func (c *ExpressCodec) Decode(_ string, value string, dst interface{}) error {
+	p, ok := dst.(*string)
+	if !ok {
+		return fmt.Errorf("redistore: ExpressCodec decodes into *string, not %T", dst)
+	}
+	if unescaped, err := url.PathUnescape(value); err == nil {
+		value = unescaped
+	}
+	signed, ok := strings.CutPrefix(value, "s:")
+	if !ok {
+		return securecookie.ErrMacInvalid
+	}
+	i := strings.LastIndexByte(signed, '.')
+	if i < 0 {
+		return securecookie.ErrMacInvalid
+	}
+	id := signed[:i]
+	if !hmac.Equal([]byte(signed[i+1:]), []byte(c.sign(id))) {
+		return securecookie.ErrMacInvalid
+	}
+	*p = id
+	return nil
+}
+
+// sign returns the signature cookie-signature computes for id.
+func (c *ExpressCodec) sign(id string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(id))
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ExpressSessionSerializer reads and writes sessions in the JSON shape of
+// express-session as stored by connect-redis. The "cookie" object holding
+// express-session's cookie settings is not part of Values: loading a session
+// applies it to the session's Options, and saving writes it from them.
+// Values otherwise behave as with JSONSerializer.
+type ExpressSessionSerializer struct{}
+
+// expressCookie is the cookie object of an express-session session.
+type expressCookie struct {
+	OriginalMaxAge *int64      `json:"originalMaxAge"`
+	Expires        *string     `json:"expires"`
+	Secure         bool        `json:"secure"`
+	HTTPOnly       bool        `json:"httpOnly"`
+	Domain         string      `json:"domain,omitempty"`
+	Path           string      `json:"path"`
+	SameSite       interface{} `json:"sameSite,omitempty"`
+}
+
+// Serialize encodes the session values and cookie options as connect-redis
+// stores them. Keys must be strings; a "cookie" value is ignored.
+func (s ExpressSessionSerializer) Serialize(ss *sessions.Session) ([]byte, error) {
+	m := make(map[string]interface{}, len(ss.Values))
+	for k, v := range ss.Values {
+		ks, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("redistore: non-string key value, cannot serialize session to JSON: %v", k)
+		}
+		if ks != "cookie" {
+			m[ks] = v
+		}
+	}
+	values, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	opts := ss.Options
+	if opts == nil {
+		opts = &sessions.Options{}
+	}
+	cookie, err := json.Marshal(newExpressCookie(opts, time.Now()))
+	if err != nil {
+		return nil, err
+	}
+
+	// express-session writes the cookie first.
+	buf := bytes.NewBufferString(`{"cookie":`)
+	buf.Write(cookie)
+	if len(values) > 2 {
+		buf.WriteByte(',')
+	}
+	buf.Write(values[1:])
+	return buf.Bytes(), nil
+}
+
+// Deserialize decodes a connect-redis session into the session's Values and
+// applies its cookie settings to the session's Options.
+func (s ExpressSessionSerializer) Deserialize(d []byte, ss *sessions.Session) error {
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(d, &m); err != nil {
+		return err
+	}
+	var payload struct {
+		Cookie *expressCookie `json:"cookie"`
+	}
+	if err := json.Unmarshal(d, &payload); err != nil {
+		return err
+	}
+	delete(m, "cookie")
+	for k, v := range m {
+		ss.Values[k] = v
+	}
+	if payload.Cookie != nil && ss.Options != nil {
+		payload.Cookie.apply(ss.Options)
+	}
+	return nil
+}
+
+// newExpressCookie returns the cookie object for opts at time now.
+func newExpressCookie(opts *sessions.Options, now time.Time) *expressCookie {
+	c := &expressCookie{
+		Secure:   opts.Secure,
+		HTTPOnly: opts.HttpOnly,
+		Domain:   opts.Domain,
+		Path:     opts.Path,
+	}
+	if c.Path == "" {
+		c.Path = "/"
+	}
+	if opts.MaxAge > 0 {
+		ms := int64(opts.MaxAge) * 1000
+		expires := now.Add(time.Duration(opts.MaxAge) * time.Second).UTC().Format("2006-01-02T15:04:05.000Z")
+		c.OriginalMaxAge, c.Expires = &ms, &expires
+	}
+	switch opts.SameSite {
+	case http.SameSiteLaxMode:
+		c.SameSite = "lax"
+	case http.SameSiteStrictMode:
+		c.SameSite = "strict"
+	case http.SameSiteNoneMode:
+		c.SameSite = "none"
+	}
+	return c
+}
+
+// apply copies the cookie settings to opts. A session cookie without a max
+// age keeps the store's MaxAge, since a MaxAge of zero would delete it.
+func (c *expressCookie) apply(opts *sessions.Options) {
+	if c.OriginalMaxAge != nil && *c.OriginalMaxAge >= 1000 {
+		opts.MaxAge = int(*c.OriginalMaxAge / 1000)
+	}
+	if c.Path != "" {
+		opts.Path = c.Path
+	}
+	opts.Domain = c.Domain
+	opts.Secure = c.Secure
+	opts.HttpOnly = c.HTTPOnly
+	switch c.SameSite {
+	case true, "strict":
+		opts.SameSite = http.SameSiteStrictMode
+	case "lax":
+		opts.SameSite = http.SameSiteLaxMode
+	case "none":
+		opts.SameSite = http.SameSiteNoneMode
+	}
+}
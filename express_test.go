@@ -0,0 +1,166 @@
+package redistore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// expressFixture is a session written the way express-session and
+// connect-redis write it, see testdata/express.
+type expressFixture struct {
+	Secret     string `json:"secret"`
+	CookieName string `json:"cookie_name"`
+	ID         string `json:"id"`
+	Cookie     string `json:"cookie"`
+	Record     string `json:"record"`
+}
+
+func loadExpressFixture(t *testing.T) expressFixture {
+	t.Helper()
+	b, err := os.ReadFile("testdata/express/fixtures.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f expressFixture
+	if err := json.Unmarshal(b, &f); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestExpressCodec(t *testing.T) {
+	f := loadExpressFixture(t)
+	codec := NewExpressCodec(f.Secret)
+
+	var id string
+	if err := codec.Decode(f.CookieName, f.Cookie, &id); err != nil || id != f.ID {
+		t.Fatalf("Expected %s; Got %q, %v", f.ID, id, err)
+	}
+	encoded, err := codec.Encode(f.CookieName, f.ID)
+	if err != nil || encoded != f.Cookie {
+		t.Errorf("Expected %s; Got %s, %v", f.Cookie, encoded, err)
+	}
+
+	for _, v := range []string{
+		strings.Replace(f.Cookie, f.ID, f.ID+"x", 1),
+		strings.TrimPrefix(f.Cookie, "s%3A"),
+		"s%3A" + f.ID,
+	} {
+		if err := codec.Decode(f.CookieName, v, &id); err == nil {
+			t.Errorf("Expected %s to be rejected", v)
+		}
+	}
+	if err := NewExpressCodec("other secret").Decode(f.CookieName, f.Cookie, &id); err == nil {
+		t.Error("Expected a cookie signed with another secret to be rejected")
+	}
+}
+
+func TestExpressSessionSerializer(t *testing.T) {
+	f := loadExpressFixture(t)
+	s := ExpressSessionSerializer{}
+	session := sessions.NewSession(nil, f.CookieName)
+	session.Options = &sessions.Options{Path: "/", MaxAge: 3600}
+	if err := s.Deserialize([]byte(f.Record), session); err != nil {
+		t.Fatalf("Error deserializing: %v", err)
+	}
+	expected := map[interface{}]interface{}{
+		"passport": map[string]interface{}{"user": "42"},
+		"views":    float64(3),
+		"flash":    map[string]interface{}{},
+	}
+	if !reflect.DeepEqual(session.Values, expected) {
+		t.Errorf("Expected %v; Got %v", expected, session.Values)
+	}
+	opts := sessions.Options{
+		Path: "/app", Domain: "example.com", MaxAge: 7 * 24 * 3600,
+		Secure: true, HttpOnly: true, SameSite: http.SameSiteStrictMode,
+	}
+	if *session.Options != opts {
+		t.Errorf("Expected options %+v; Got %+v", opts, *session.Options)
+	}
+
+	b, err := s.Serialize(session)
+	if err != nil {
+		t.Fatalf("Error serializing: %v", err)
+	}
+	prefix := `{"cookie":{"originalMaxAge":604800000,"expires":"`
+	if !strings.HasPrefix(string(b), prefix) {
+		t.Errorf("Expected %s to start with %s", b, prefix)
+	}
+	var got, want map[string]interface{}
+	json.Unmarshal(b, &got)
+	json.Unmarshal([]byte(f.Record), &want)
+	expires, _ := time.Parse(time.RFC3339, got["cookie"].(map[string]interface{})["expires"].(string))
+	if d := time.Until(expires); d < 7*24*time.Hour-time.Minute || d > 7*24*time.Hour {
+		t.Errorf("Expected expiry in 7 days; Got %v", expires)
+	}
+	delete(got["cookie"].(map[string]interface{}), "expires")
+	delete(want["cookie"].(map[string]interface{}), "expires")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v; Got %v", want, got)
+	}
+
+	session.Values = map[interface{}]interface{}{}
+	session.Options = &sessions.Options{}
+	if b, _ := s.Serialize(session); string(b) != `{"cookie":{"originalMaxAge":null,"expires":null,"secure":false,"httpOnly":false,"path":"/"}}` {
+		t.Errorf("Unexpected empty session %s", b)
+	}
+}
+
+func TestExpressSessionSharing(t *testing.T) {
+	ctx := context.Background()
+	f := loadExpressFixture(t)
+	store, err := NewRediStore([]string{setup()}, false)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	store.Codecs = []securecookie.Codec{NewExpressCodec(f.Secret)}
+	store.SetSerializer(ExpressSessionSerializer{})
+	store.SetKeyPrefix("sess:")
+
+	// A session created by the Node.js application.
+	if err := store.Client.Set(ctx, "sess:"+f.ID, f.Record, time.Minute).Err(); err != nil {
+		t.Fatal(err)
+	}
+	defer store.DestroySession(ctx, f.ID)
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", f.CookieName+"="+f.Cookie)
+	session, err := store.Get(req, f.CookieName)
+	if err != nil || session.IsNew || session.ID != f.ID {
+		t.Fatalf("Expected the express session; Got %q, new %v, %v", session.ID, session.IsNew, err)
+	}
+
+	session.Values["views"] = 4
+	rsp := httptest.NewRecorder()
+	if err := store.Save(req, rsp, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	c := rsp.Result().Cookies()[0]
+	if c.Value != f.Cookie || c.Path != "/app" || c.Domain != "example.com" || !c.Secure {
+		t.Errorf("Expected the express cookie; Got %+v", c)
+	}
+	if ttl := store.Client.TTL(ctx, "sess:"+f.ID).Val(); ttl < 7*24*time.Hour-time.Minute {
+		t.Errorf("Expected the express max age as TTL; Got %v", ttl)
+	}
+	raw, _ := store.Client.Get(ctx, "sess:"+f.ID).Result()
+	if !strings.Contains(raw, `"views":4`) || !strings.Contains(raw, `"passport":{"user":"42"}`) {
+		t.Errorf("Expected the updated session for express; Got %s", raw)
+	}
+}
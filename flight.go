@@ -0,0 +1,63 @@
+package redistore
+
+import "sync"
+
+// flightGroup coalesces concurrent reads of the same session within a
+// process, so a burst of requests for one session makes a single round trip.
+// Callers share the payload read, not a session, and deserialize it each
+// into their own Values. The zero value is ready to use.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+}
+
+// flight is a read in progress or completed.
+type flight struct {
+	wg      sync.WaitGroup
+	data    string
+	revoked bool
+	err     error
+}
+
+// do calls fn for the session with the given ID, unless a call for it is
+// already in flight, in which case it waits for that call and returns its
+// results.
+func (g *flightGroup) do(id string, fn func() (string, bool, error)) (string, bool, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flight)
+	}
+	if f, ok := g.calls[id]; ok {
+		g.mu.Unlock()
+		f.wg.Wait()
+		return f.data, f.revoked, f.err
+	}
+	f := new(flight)
+	f.wg.Add(1)
+	g.calls[id] = f
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		if g.calls[id] == f {
+			delete(g.calls, id)
+		}
+		g.mu.Unlock()
+		f.wg.Done()
+	}()
+	f.data, f.revoked, f.err = fn()
+	return f.data, f.revoked, f.err
+}
+
+// forget makes later reads of the session with the given ID, or of every
+// session for the ID "*", start a new call instead of joining one in flight,
+// which may have started before a write that just completed.
+func (g *flightGroup) forget(id string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if id == "*" {
+		g.calls = nil
+		return
+	}
+	delete(g.calls, id)
+}
@@ -0,0 +1,134 @@
+package redistore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestFlightGroup(t *testing.T) {
+	var g flightGroup
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func() (string, bool, error) {
+		calls.Add(1)
+		<-release
+		return "data", false, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]string, 10)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _, _ = g.do("id", fn)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected 1 call; Got %d", n)
+	}
+	for _, r := range results {
+		if r != "data" {
+			t.Errorf("Expected data; Got %q", r)
+		}
+	}
+
+	// Forgotten calls are not joined.
+	release = make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		g.do("id", fn)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	g.forget("id")
+	go close(release)
+	g.do("id", fn)
+	<-done
+	if n := calls.Load(); n != 3 {
+		t.Errorf("Expected 3 calls; Got %d", n)
+	}
+}
+
+// gateHook counts GET commands and holds them until released.
+type gateHook struct {
+	gets    atomic.Int32
+	release chan struct{}
+}
+
+func (h *gateHook) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (h *gateHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if cmd.Name() == "get" {
+			h.gets.Add(1)
+			<-h.release
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h *gateHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func TestCoalescedLoads(t *testing.T) {
+	store, err := NewRediStore([]string{setup()}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	store.SetKeyPrefix("flight_test_")
+	defer purgeSessions(t, store)
+	req, err := saveValues(t, store, map[interface{}]interface{}{"roles": []string{"admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook := &gateHook{release: make(chan struct{})}
+	store.Client.AddHook(hook)
+
+	var wg sync.WaitGroup
+	loaded := make([]*sessions.Session, 20)
+	errs := make([]error, len(loaded))
+	for i := range loaded {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			loaded[i], errs[i] = store.New(req, "session-key")
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(hook.release)
+	wg.Wait()
+	if n := hook.gets.Load(); n != 1 {
+		t.Errorf("Expected 1 GET; Got %d", n)
+	}
+
+	// Every caller gets its own copy of the values.
+	for i := range loaded {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+	}
+	loaded[0].Values["roles"].([]string)[0] = "guest"
+	loaded[0].Values["extra"] = true
+	for _, session := range loaded[1:] {
+		if roles := session.Values["roles"].([]string); roles[0] != "admin" || session.Values["extra"] != nil {
+			t.Fatalf("Expected independent values; Got %v", session.Values)
+		}
+	}
+}
@@ -6,6 +6,7 @@ require (
 	github.com/gorilla/securecookie v1.1.2
 	github.com/gorilla/sessions v1.4.0
 	github.com/redis/go-redis/v9 v9.11.0
+	github.com/yuin/gopher-lua v1.1.1
 )
 
 require (
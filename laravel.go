@@ -0,0 +1,252 @@
+package redistore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// ErrLaravelMAC is returned when a Laravel payload fails MAC verification,
+// usually because it was encrypted with a different APP_KEY.
+var ErrLaravelMAC = errors.New("redistore: invalid Laravel payload MAC")
+
+// LaravelCodec is a securecookie.Codec reading and writing the encrypted
+// session cookie of Laravel 8 and later, whose Encrypter uses AES-256-CBC
+// with an HMAC-SHA256 over a base64 JSON envelope. Sessions shared with
+// Laravel are set up as
+//
+//	codec, err := redistore.NewLaravelCodec(os.Getenv("APP_KEY"))
+//	store.Codecs = []securecookie.Codec{codec}
+//	store.SetSerializer(redistore.LaravelSerializer{})
+//	store.SetKeyPrefix("laravel_database_laravel_cache_:")
+//
+// and used with the session name "laravel_session". Both names derive from
+// APP_NAME, and the key prefix from the Redis and cache prefixes configured in
+// Laravel. A codec per key, current one first, accepts cookies encrypted with
+// a previous APP_KEY.
+type LaravelCodec struct {
+	key []byte
+}
+
+// NewLaravelCodec returns a LaravelCodec for the given Laravel APP_KEY, either
+// "base64:" followed by the base64 encoded key or the raw 32 byte key.
+func NewLaravelCodec(appKey string) (*LaravelCodec, error) {
+	key := []byte(appKey)
+	if b64, ok := strings.CutPrefix(appKey, "base64:"); ok {
+		var err error
+		if key, err = base64.StdEncoding.DecodeString(b64); err != nil {
+			return nil, fmt.Errorf("redistore: invalid Laravel APP_KEY: %w", err)
+		}
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("redistore: Laravel APP_KEY must be 32 bytes for AES-256-CBC, got %d", len(key))
+	}
+	return &LaravelCodec{key: key}, nil
+}
+
+// laravelPayload is the JSON envelope of a Laravel encrypted value.
+type laravelPayload struct {
+	IV    string `json:"iv"`
+	Value string `json:"value"`
+	MAC   string `json:"mac"`
+	Tag   string `json:"tag"`
+}
+
+// Encode encrypts the session ID in value as Laravel's EncryptCookies
+// middleware does, prefixing it with the cookie name's HMAC.
+func (c *LaravelCodec) Encode(name string, value interface{}) (string, error) {
+	id, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("redistore: LaravelCodec encodes session ID strings, not %T", value)
+	}
+	payload, err := c.encrypt([]byte(c.cookiePrefix(name) + id))
+	if err != nil {
+		return "", err
+	}
+	// PHP URL encodes cookie values.
+	return url.QueryEscape(payload), nil
+}
+
+// Decode decrypts a Laravel session cookie into dst, which must be a *string.
+func (c *LaravelCodec) Decode(name string, value string, dst interface{}) error {
+	p, ok := dst.(*string)
+	if !ok {
+		return fmt.Errorf("redistore: LaravelCodec decodes into *string, not %T", dst)
+	}
+	if unescaped, err := url.PathUnescape(value); err == nil {
+		value = unescaped
+	}
+	plain, err := c.decrypt(value)
+	if err != nil {
+		return err
+	}
+	id, ok := strings.CutPrefix(string(plain), c.cookiePrefix(name))
+	if !ok {
+		return securecookie.ErrMacInvalid
+	}
+	*p = id
+	return nil
+}
+
+// cookiePrefix returns the prefix Laravel adds to encrypted cookie values to
+// bind them to the cookie name.
+func (c *LaravelCodec) cookiePrefix(name string) string {
+	mac := hmac.New(sha1.New, c.key)
+	mac.Write([]byte(name + "v2"))
+	return hex.EncodeToString(mac.Sum(nil)) + "|"
+}
+
+// mac returns the hex encoded MAC Laravel computes over a payload.
+func (c *LaravelCodec) mac(iv, value string) string {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(iv + value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// encrypt returns plain encrypted as a Laravel payload.
+func (c *LaravelCodec) encrypt(plain []byte) (string, error) {
+	block, err := aes.NewCipher(c.key)
+	if err != nil {
+		return "", err
+	}
+	iv := securecookie.GenerateRandomKey(aes.BlockSize)
+	if iv == nil {
+		return "", errors.New("redistore: failed to generate IV")
+	}
+	pad := aes.BlockSize - len(plain)%aes.BlockSize
+	data := append(append([]byte(nil), plain...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+	p := laravelPayload{
+		IV:    base64.StdEncoding.EncodeToString(iv),
+		Value: base64.StdEncoding.EncodeToString(data),
+	}
+	p.MAC = c.mac(p.IV, p.Value)
+	b, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// decrypt verifies and decrypts a Laravel payload.
+func (c *LaravelCodec) decrypt(payload string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("redistore: invalid Laravel payload: %w", err)
+	}
+	var p laravelPayload
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("redistore: invalid Laravel payload: %w", err)
+	}
+	if !hmac.Equal([]byte(c.mac(p.IV, p.Value)), []byte(p.MAC)) {
+		return nil, ErrLaravelMAC
+	}
+	iv, err := base64.StdEncoding.DecodeString(p.IV)
+	if err != nil || len(iv) != aes.BlockSize {
+		return nil, errors.New("redistore: invalid Laravel payload IV")
+	}
+	data, err := base64.StdEncoding.DecodeString(p.Value)
+	if err != nil || len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("redistore: invalid Laravel payload value")
+	}
+	block, err := aes.NewCipher(c.key)
+	if err != nil {
+		return nil, err
+	}
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, data)
+	pad := int(data[len(data)-1])
+	if pad == 0 || pad > aes.BlockSize || !bytes.Equal(data[len(data)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, errors.New("redistore: invalid Laravel payload padding")
+	}
+	return data[:len(data)-pad], nil
+}
+
+// LaravelSerializer reads and writes sessions as Laravel's cache based
+// session handlers store them in Redis: the session attributes serialized
+// as a PHP array, serialized again as a string by the cache store. Values
+// are represented as with PHPSessionSerializer.
+//
+// Laravel only accepts session IDs of 40 letters and digits, so it ignores
+// sessions started by this store; sessions meant to be shared must be
+// started by Laravel.
+//
+// Laravel keeps its own flash data under "_flash", which gorilla/sessions
+// also uses for flashes without a key, so Go code sharing sessions with
+// Laravel must pass a key to AddFlash and Flashes.
+//
+// Fields:
+//
+//	Encrypter: Decrypts and encrypts the attributes when Laravel's
+//	  session.encrypt option is on. Nil for unencrypted sessions.
+type LaravelSerializer struct {
+	Encrypter *LaravelCodec
+}
+
+// Serialize encodes the session values as Laravel stores them.
+func (s LaravelSerializer) Serialize(ss *sessions.Session) ([]byte, error) {
+	attributes, err := PHPSessionSerializer{Format: PHPFormatSerialize}.Serialize(ss)
+	if err != nil {
+		return nil, err
+	}
+	data := string(attributes)
+	if s.Encrypter != nil {
+		// Laravel's Encrypter serializes what it encrypts.
+		buf := new(bytes.Buffer)
+		writePHPString(buf, data)
+		if data, err = s.Encrypter.encrypt(buf.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	buf := new(bytes.Buffer)
+	writePHPString(buf, data)
+	return buf.Bytes(), nil
+}
+
+// Deserialize decodes a session stored by Laravel into the session's Values.
+func (s LaravelSerializer) Deserialize(d []byte, ss *sessions.Session) error {
+	data, err := unserializePHPString(d)
+	if err != nil {
+		return err
+	}
+	if s.Encrypter != nil {
+		plain, err := s.Encrypter.decrypt(string(data))
+		if err != nil {
+			return err
+		}
+		if data, err = unserializePHPString(plain); err != nil {
+			return err
+		}
+	}
+	return PHPSessionSerializer{Format: PHPFormatSerialize}.Deserialize(data, ss)
+}
+
+// unserializePHPString decodes d, which must hold a single serialized string.
+func unserializePHPString(d []byte) ([]byte, error) {
+	dec := &phpDecoder{b: d}
+	if len(d) < 2 || d[0] != 's' || d[1] != ':' {
+		return nil, dec.errorf("expected a serialized string")
+	}
+	dec.pos = 2
+	s, err := dec.str()
+	if err != nil {
+		return nil, err
+	}
+	if err := dec.end(); err != nil {
+		return nil, err
+	}
+	return []byte(s), nil
+}
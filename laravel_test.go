@@ -0,0 +1,173 @@
+package redistore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// laravelFixture is a session written the way Laravel writes it, see
+// testdata/laravel.
+type laravelFixture struct {
+	AppKey          string `json:"app_key"`
+	CookieName      string `json:"cookie_name"`
+	Cookie          string `json:"cookie"`
+	ID              string `json:"id"`
+	Token           string `json:"token"`
+	LoginKey        string `json:"login_key"`
+	Record          string `json:"record"`
+	EncryptedRecord string `json:"encrypted_record"`
+}
+
+func loadLaravelFixture(t *testing.T) laravelFixture {
+	t.Helper()
+	b, err := os.ReadFile("testdata/laravel/fixtures.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f laravelFixture
+	if err := json.Unmarshal(b, &f); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestLaravelCodec(t *testing.T) {
+	f := loadLaravelFixture(t)
+	codec, err := NewLaravelCodec(f.AppKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var id string
+	if err := codec.Decode(f.CookieName, f.Cookie, &id); err != nil || id != f.ID {
+		t.Fatalf("Expected %s; Got %q, %v", f.ID, id, err)
+	}
+	if err := codec.Decode("other_cookie", f.Cookie, &id); err == nil {
+		t.Error("Expected the cookie to be bound to its name")
+	}
+	tampered := strings.Replace(f.Cookie, "eyJpdiI6I", "eyJpdiI6J", 1)
+	if err := codec.Decode(f.CookieName, tampered, &id); err == nil {
+		t.Error("Expected a tampered cookie to be rejected")
+	}
+	other, _ := NewLaravelCodec(strings.Repeat("k", 32))
+	if err := other.Decode(f.CookieName, f.Cookie, &id); !errors.Is(err, ErrLaravelMAC) {
+		t.Errorf("Expected ErrLaravelMAC for another key; Got %v", err)
+	}
+
+	encoded, err := codec.Encode(f.CookieName, f.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id = ""
+	if err := codec.Decode(f.CookieName, encoded, &id); err != nil || id != f.ID {
+		t.Errorf("Expected round trip of %s; Got %q, %v", f.ID, id, err)
+	}
+
+	for _, key := range []string{"short", "base64:!!", "base64:" + strings.Repeat("A", 12)} {
+		if _, err := NewLaravelCodec(key); err == nil {
+			t.Errorf("Expected an error for APP_KEY %q", key)
+		}
+	}
+}
+
+func TestLaravelSerializer(t *testing.T) {
+	f := loadLaravelFixture(t)
+	codec, _ := NewLaravelCodec(f.AppKey)
+	for name, tc := range map[string]struct {
+		s      LaravelSerializer
+		record string
+	}{
+		"plain":     {LaravelSerializer{}, f.Record},
+		"encrypted": {LaravelSerializer{Encrypter: codec}, f.EncryptedRecord},
+	} {
+		t.Run(name, func(t *testing.T) {
+			session := sessions.NewSession(nil, f.CookieName)
+			if err := tc.s.Deserialize([]byte(tc.record), session); err != nil {
+				t.Fatalf("Error deserializing: %v", err)
+			}
+			if session.Values["_token"] != f.Token || session.Values[f.LoginKey] != 42 {
+				t.Errorf("Unexpected values %v", session.Values)
+			}
+			previous, _ := session.Values["_previous"].(map[string]interface{})
+			if previous["url"] != "http://localhost/login" {
+				t.Errorf("Expected previous URL; Got %v", session.Values["_previous"])
+			}
+
+			b, err := tc.s.Serialize(session)
+			if err != nil {
+				t.Fatalf("Error serializing: %v", err)
+			}
+			if name == "plain" && string(b) != f.Record {
+				t.Errorf("Expected %s; Got %s", f.Record, b)
+			}
+			reloaded := sessions.NewSession(nil, f.CookieName)
+			if err := tc.s.Deserialize(b, reloaded); err != nil || reloaded.Values["_token"] != f.Token {
+				t.Errorf("Expected round trip; Got %v, %v", reloaded.Values, err)
+			}
+		})
+	}
+
+	session := sessions.NewSession(nil, f.CookieName)
+	if err := (LaravelSerializer{}).Deserialize([]byte(`a:0:{}`), session); err == nil {
+		t.Error("Expected an error for an unwrapped array")
+	}
+}
+
+func TestLaravelSessionSharing(t *testing.T) {
+	ctx := context.Background()
+	f := loadLaravelFixture(t)
+	codec, _ := NewLaravelCodec(f.AppKey)
+	store, err := NewRediStore([]string{setup()}, false)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	store.Codecs = []securecookie.Codec{codec}
+	store.SetSerializer(LaravelSerializer{})
+	store.SetKeyPrefix("laravel_database_laravel_cache_:")
+
+	// A session started by the Laravel frontend.
+	if err := store.Client.Set(ctx, "laravel_database_laravel_cache_:"+f.ID, f.Record, time.Minute).Err(); err != nil {
+		t.Fatal(err)
+	}
+	defer store.DestroySession(ctx, f.ID)
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", f.CookieName+"="+f.Cookie)
+	session, err := store.Get(req, f.CookieName)
+	if err != nil || session.IsNew || session.ID != f.ID {
+		t.Fatalf("Expected the Laravel session; Got %q, new %v, %v", session.ID, session.IsNew, err)
+	}
+
+	session.Values["cart"] = []interface{}{"sku-1"}
+	rsp := httptest.NewRecorder()
+	if err := store.Save(req, rsp, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	var id string
+	if err := codec.Decode(f.CookieName, rsp.Result().Cookies()[0].Value, &id); err != nil || id != f.ID {
+		t.Errorf("Expected a Laravel cookie for %s; Got %q, %v", f.ID, id, err)
+	}
+	raw, err := store.Client.Get(ctx, "laravel_database_laravel_cache_:"+f.ID).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(raw, "s:") || !strings.Contains(raw, `s:4:"cart";a:1:{i:0;s:5:"sku-1";}`) {
+		t.Errorf("Expected the cart in the Laravel payload; Got %s", raw)
+	}
+}
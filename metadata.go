@@ -0,0 +1,166 @@
+package redistore
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/redis/go-redis/v9"
+)
+
+// Metadata describes a session independently of its values. It is kept in a
+// Redis hash next to the session and expires with it.
+//
+// Fields:
+//
+//	Name: The name the session was saved under.
+//	CreatedAt: When the session ID was issued.
+//	LastSeen: When the session was last loaded or saved.
+//	IP: The client IP address of the last request, taken from RemoteAddr.
+//	UserAgent: The User-Agent header of the last request.
+type Metadata struct {
+	Name      string    `json:"name,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+}
+
+// SetSessionMetadata enables the metadata record. While enabled, Save records
+// the session name, issue time, client IP and user agent, and New refreshes
+// the last access time, IP and user agent of every session it loads. This
+// costs one additional write per load; a failure of that write is ignored.
+//
+// Applications behind a proxy should rewrite Request.RemoteAddr from the
+// forwarding headers they trust before the store sees the request.
+func (s *RediStore) SetSessionMetadata(enabled bool) {
+	s.metadata = enabled
+}
+
+// Metadata returns the metadata recorded for session, or nil if there is none.
+func (s *RediStore) Metadata(ctx context.Context, session *sessions.Session) (*Metadata, error) {
+	fields, err := s.Client.HGetAll(ctx, s.metaKey(session.ID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	return parseMetadata(fields), nil
+}
+
+// metaKey returns the key of the hash holding metadata about a session.
+func (s *RediStore) metaKey(id string) string {
+	return s.keyPrefix + id + ":meta"
+}
+
+// writeMeta stores the metadata of a session being saved and extends it to
+// live as long as the session. The issue time is only set once per session
+// ID. It runs after the session itself is stored; a new session's cookie is
+// only sent once Save returns, so no load can observe the session without its
+// issue time. With an ack, it waits for the metadata to be replicated too.
+func (s *RediStore) writeMeta(ctx context.Context, r *http.Request, session *sessions.Session, age int, ack *SaveAck) error {
+	var c redis.Cmdable = s.Client
+	if ack != nil {
+		var err error
+		if c, err = s.ackClient(ctx, s.metaKey(session.ID)); err != nil {
+			return err
+		}
+	}
+	var wait *redis.Cmd
+	_, err := c.Pipelined(ctx, func(p redis.Pipeliner) error {
+		s.queueMeta(ctx, p, r, session, age)
+		wait = ack.queue(ctx, p)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return ack.check(wait)
+}
+
+// queueMeta adds the commands writing the metadata of a saved session to p.
+func (s *RediStore) queueMeta(ctx context.Context, p redis.Pipeliner, r *http.Request, session *sessions.Session, age int) {
+	key := s.metaKey(session.ID)
+	now := time.Now().UnixMilli()
+	p.HSetNX(ctx, key, "iat", now)
+	if s.metadata {
+		p.HSet(ctx, key, "name", session.Name(), "seen", now, "ip", clientIP(r), "ua", userAgent(r))
+	}
+	p.Expire(ctx, key, time.Duration(age)*time.Second)
+}
+
+// touchMeta refreshes the last access time, IP and user agent of a loaded
+// session. Metadata that has expired or was never written is left alone.
+func (s *RediStore) touchMeta(ctx context.Context, r *http.Request, session *sessions.Session) error {
+	return touchMetaScript.Run(ctx, s.Client, []string{s.metaKey(session.ID)},
+		time.Now().UnixMilli(), clientIP(r), userAgent(r)).Err()
+}
+
+// touchMetaScript updates an existing metadata hash.
+//
+// KEYS[1] session metadata key. ARGV[1] now in milliseconds, ARGV[2] client
+// IP, ARGV[3] user agent.
+var touchMetaScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+  redis.call('HSET', KEYS[1], 'seen', ARGV[1], 'ip', ARGV[2], 'ua', ARGV[3])
+end
+return 1
+`)
+
+// parseMetadata converts a metadata hash to Metadata, returning nil for an
+// empty hash.
+func parseMetadata(fields map[string]string) *Metadata {
+	if len(fields) == 0 {
+		return nil
+	}
+	md := &Metadata{
+		Name:      fields["name"],
+		IP:        fields["ip"],
+		UserAgent: fields["ua"],
+	}
+	if ms, err := strconv.ParseInt(fields["iat"], 10, 64); err == nil {
+		md.CreatedAt = time.UnixMilli(ms)
+	}
+	if ms, err := strconv.ParseInt(fields["seen"], 10, 64); err == nil {
+		md.LastSeen = time.UnixMilli(ms)
+	}
+	return md
+}
+
+// metadataFields converts md back to the field/value pairs of a metadata
+// hash, omitting unset fields.
+func metadataFields(md *Metadata) []interface{} {
+	var fields []interface{}
+	add := func(name string, value interface{}, set bool) {
+		if set {
+			fields = append(fields, name, value)
+		}
+	}
+	add("name", md.Name, md.Name != "")
+	add("iat", md.CreatedAt.UnixMilli(), !md.CreatedAt.IsZero())
+	add("seen", md.LastSeen.UnixMilli(), !md.LastSeen.IsZero())
+	add("ip", md.IP, md.IP != "")
+	add("ua", md.UserAgent, md.UserAgent != "")
+	return fields
+}
+
+// clientIP returns the host part of the request's remote address.
+func clientIP(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// userAgent returns the User-Agent header of r, if any.
+func userAgent(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	return r.UserAgent()
+}
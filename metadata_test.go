@@ -0,0 +1,139 @@
+package redistore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// readOnlyError is the error of a write sent to a replica.
+type readOnlyError struct{}
+
+func (readOnlyError) Error() string { return "READONLY You can't write against a read only replica." }
+
+func (readOnlyError) RedisError() {}
+
+// failScripts makes hook fail the scripts run by the store with err.
+func failScripts(hook *outageHook, err error) {
+	hook.set(func(cmd redis.Cmder) bool {
+		if cmd.Name() != "evalsha" && cmd.Name() != "eval" {
+			return false
+		}
+		cmd.SetErr(err)
+		return true
+	})
+}
+
+func TestSessionMetadata(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewRediStore([]string{setup()}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	store.SetKeyPrefix("metadata_test_")
+	store.SetUserIDFunc(UserIDFromValue("user_id"))
+	store.SetSessionMetadata(true)
+	defer store.DestroyUserSessions(ctx, "gina")
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("User-Agent", "first")
+	session, _ := store.New(req, "session-key")
+	session.Values["user_id"] = "gina"
+	rsp := httptest.NewRecorder()
+	if err = store.Save(req, rsp, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+
+	md, err := store.Metadata(ctx, session)
+	if err != nil || md == nil {
+		t.Fatalf("Expected metadata; Got %v, %v", md, err)
+	}
+	if md.Name != "session-key" || md.IP != "192.0.2.1" || md.UserAgent != "first" {
+		t.Errorf("Unexpected metadata %+v", md)
+	}
+	if md.CreatedAt.IsZero() || md.LastSeen.Before(md.CreatedAt) {
+		t.Errorf("Unexpected timestamps %+v", md)
+	}
+	if _, ok := session.Values["ip"]; ok || len(session.Values) != 1 {
+		t.Errorf("Expected values to be untouched; Got %v", session.Values)
+	}
+
+	// Loading the session records the latest access.
+	time.Sleep(2 * time.Millisecond)
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.RemoteAddr = "198.51.100.7:4321"
+	req.Header.Set("User-Agent", "second")
+	req.Header.Add("Cookie", rsp.Header().Get("Set-Cookie"))
+	if _, err = store.New(req, "session-key"); err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+
+	recs, err := store.UserSessionRecords(ctx, "gina")
+	if err != nil || len(recs) != 1 {
+		t.Fatalf("Expected 1 record; Got %v, %v", recs, err)
+	}
+	got := recs[0].Metadata
+	if got == nil || got.IP != "198.51.100.7" || got.UserAgent != "second" {
+		t.Fatalf("Expected refreshed metadata; Got %+v", got)
+	}
+	if !got.CreatedAt.Equal(md.CreatedAt) || !got.LastSeen.After(md.LastSeen) {
+		t.Errorf("Expected only the last access to move; Got %+v, was %+v", got, md)
+	}
+	if recs[0].TTL <= 0 || recs[0].Values["user_id"] != "gina" {
+		t.Errorf("Unexpected record %+v", recs[0])
+	}
+
+	if _, err = store.LookupSession(ctx, "missing"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Expected ErrSessionNotFound; Got %v", err)
+	}
+
+	// Deleting the session removes its metadata.
+	session.Options.MaxAge = -1
+	if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error deleting session: %v", err)
+	}
+	if md, _ = store.Metadata(ctx, session); md != nil {
+		t.Errorf("Expected metadata to be deleted; Got %+v", md)
+	}
+}
+
+func TestSessionMetadataTouchFailure(t *testing.T) {
+	store, err := NewRediStore([]string{setup()}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	store.SetKeyPrefix("metadata_test_")
+	store.SetSessionMetadata(true)
+	defer purgeSessions(t, store)
+	req, err := saveValues(t, store, map[interface{}]interface{}{"user": "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed last access update does not fail the load.
+	hook := &outageHook{}
+	store.Client.AddHook(hook)
+	failScripts(hook, readOnlyError{})
+	defer hook.set(nil)
+	session, err := store.New(req, "session-key")
+	if err != nil || session.IsNew || session.Values["user"] != "alice" {
+		t.Errorf("Expected the saved session; Got %v, %v", session.Values, err)
+	}
+}
@@ -0,0 +1,222 @@
+package redistore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+
+	"github.com/gorilla/sessions"
+)
+
+// ErrNoSessionMiddleware is returned by FromContext for contexts of requests
+// that did not pass through Middleware.
+var ErrNoSessionMiddleware = errors.New("redistore: no session middleware in context")
+
+// MiddlewareOptions configures MiddlewareWithOptions.
+//
+// Fields:
+//
+//	OnError: Called when saving the session fails, before anything of the
+//	  response has been written. The default responds with 500 Internal
+//	  Server Error. Whatever the handler writes afterwards is discarded. An
+//	  *AckError is not a failure: the session is stored and its cookie set,
+//	  so the response goes on.
+type MiddlewareOptions struct {
+	OnError func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// Middleware returns net/http middleware managing the session with the given
+// name. The session is loaded on the first call of FromContext and saved, if
+// it was modified, just before the response status is written or when the
+// handler returns, whichever comes first. Handlers need not call Save.
+//
+// A session counts as modified if its values, ID or options differ from
+// those it was loaded with, compared after a round trip through the store's
+// serializer (gob for stores other than RediStore). Mutations made after the
+// response has started are not saved.
+func Middleware(store sessions.Store, name string) func(http.Handler) http.Handler {
+	return MiddlewareWithOptions(store, name, MiddlewareOptions{})
+}
+
+// MiddlewareWithOptions is Middleware with options.
+func MiddlewareWithOptions(store sessions.Store, name string, opts MiddlewareOptions) func(http.Handler) http.Handler {
+	if opts.OnError == nil {
+		opts.OnError = func(w http.ResponseWriter, _ *http.Request, _ error) {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			st := &sessionState{store: store, name: name, opts: opts, w: w}
+			r = r.WithContext(context.WithValue(r.Context(), sessionContextKey, st))
+			st.r = r
+			sw := &sessionWriter{ResponseWriter: w, state: st}
+			next.ServeHTTP(sw, r)
+			_ = sw.commit()
+		})
+	}
+}
+
+// FromContext returns the session of the request the context belongs to,
+// loading it on first use. As with Store.Get, a session is returned along
+// with any error loading it, so a request with an invalid cookie still gets
+// a new session.
+//
+// After an error the session is only saved if it has no ID, so a session
+// that could not be read, e.g. because Redis was unavailable, is never
+// overwritten with an empty one. Sessions whose cookie failed to decode have
+// no ID and are saved as new sessions.
+func FromContext(ctx context.Context) (*sessions.Session, error) {
+	st, ok := ctx.Value(sessionContextKey).(*sessionState)
+	if !ok {
+		return nil, ErrNoSessionMiddleware
+	}
+	return st.load()
+}
+
+// contextKey is the type of context keys of this package.
+type contextKey int
+
+const (
+	sessionContextKey contextKey = iota
+	registeredContextKey
+)
+
+// sessionState is the session of one request handled by Middleware.
+type sessionState struct {
+	store sessions.Store
+	name  string
+	opts  MiddlewareOptions
+	r     *http.Request
+	w     http.ResponseWriter
+
+	mu       sync.Mutex
+	loaded   bool
+	session  *sessions.Session
+	err      error
+	snapshot sessionSnapshot
+	saved    bool
+	saveErr  error
+}
+
+// sessionSnapshot is a session as it was loaded.
+type sessionSnapshot struct {
+	values  map[interface{}]interface{}
+	id      string
+	options sessions.Options
+	ok      bool
+}
+
+func (st *sessionState) load() (*sessions.Session, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if !st.loaded {
+		st.loaded = true
+		st.session, st.err = st.store.New(st.r, st.name)
+		if st.session != nil {
+			st.snapshot = takeSnapshot(st.store, st.session)
+		}
+	}
+	return st.session, st.err
+}
+
+// takeSnapshot copies the session by a round trip through the serializer of
+// store.
+func takeSnapshot(store sessions.Store, session *sessions.Session) sessionSnapshot {
+	var serializer SessionSerializer = GobSerializer{}
+	if rs, ok := store.(*RediStore); ok {
+		serializer = rs.serializer
+	}
+	snap := sessionSnapshot{id: session.ID}
+	if session.Options != nil {
+		snap.options = *session.Options
+	}
+	b, err := serializer.Serialize(session)
+	if err != nil {
+		return snap
+	}
+	cp := sessions.NewSession(store, session.Name())
+	if err := serializer.Deserialize(b, cp); err != nil {
+		return snap
+	}
+	snap.values, snap.ok = cp.Values, true
+	return snap
+}
+
+// modified reports whether the session differs from the snapshot. A session
+// that could not be copied always counts as modified.
+func (snap sessionSnapshot) modified(store sessions.Store, session *sessions.Session) bool {
+	if !snap.ok || session.ID != snap.id {
+		return true
+	}
+	if session.Options != nil && *session.Options != snap.options {
+		return true
+	}
+	return !reflect.DeepEqual(takeSnapshot(store, session).values, snap.values)
+}
+
+// save saves the session once, if it was loaded and modified, and reports
+// the error handled by OnError, if any.
+func (st *sessionState) save() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.saved {
+		return st.saveErr
+	}
+	st.saved = true
+	if st.session == nil || (st.err != nil && st.session.ID != "") || !st.snapshot.modified(st.store, st.session) {
+		return nil
+	}
+	err := st.store.Save(st.r, st.w, st.session)
+	var ackErr *AckError
+	if err != nil && !errors.As(err, &ackErr) {
+		st.saveErr = err
+		st.opts.OnError(st.w, st.r, err)
+	}
+	return st.saveErr
+}
+
+// sessionWriter saves the session before the response starts.
+type sessionWriter struct {
+	http.ResponseWriter
+	state *sessionState
+}
+
+// commit saves the session, returning the error handled by OnError, in
+// which case the response must not go on.
+func (sw *sessionWriter) commit() error {
+	return sw.state.save()
+}
+
+// WriteHeader saves the session, then writes the status code.
+func (sw *sessionWriter) WriteHeader(code int) {
+	if sw.commit() == nil {
+		sw.ResponseWriter.WriteHeader(code)
+	}
+}
+
+// Write saves the session, then writes b. It returns the save error if
+// saving failed.
+func (sw *sessionWriter) Write(b []byte) (int, error) {
+	if err := sw.commit(); err != nil {
+		return 0, err
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+// Flush saves the session, then flushes the response if supported.
+func (sw *sessionWriter) Flush() {
+	if sw.commit() != nil {
+		return
+	}
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController.
+func (sw *sessionWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
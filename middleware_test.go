@@ -0,0 +1,246 @@
+package redistore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/securecookie"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMiddleware(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewRediStore([]string{setup()}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	store.SetKeyPrefix("middleware_test_")
+	defer purgeSessions(t, store)
+
+	var handler http.HandlerFunc
+	srv := Middleware(store, "session-key")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r)
+	}))
+	serve := func(cookie string) *http.Response {
+		req := httptest.NewRequest("GET", "http://localhost/", nil)
+		if cookie != "" {
+			req.Header.Set("Cookie", cookie)
+		}
+		rsp := httptest.NewRecorder()
+		srv.ServeHTTP(rsp, req)
+		return rsp.Result()
+	}
+
+	// A modified session is saved before the body is written.
+	handler = func(w http.ResponseWriter, r *http.Request) {
+		session, err := FromContext(r.Context())
+		if err != nil {
+			t.Errorf("Error getting session: %v", err)
+		}
+		session.Values["views"] = 1
+		io.WriteString(w, "hello")
+	}
+	rsp := serve("")
+	cookie := rsp.Header.Get("Set-Cookie")
+	if cookie == "" {
+		t.Fatal("Expected a session cookie")
+	}
+
+	// An unmodified session is not saved again.
+	handler = func(w http.ResponseWriter, r *http.Request) {
+		session, _ := FromContext(r.Context())
+		if session.IsNew || session.Values["views"] != 1 {
+			t.Errorf("Expected the saved session; Got %v", session.Values)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+	if rsp := serve(cookie); rsp.Header.Get("Set-Cookie") != "" || rsp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected no cookie and 204; Got %v, %d", rsp.Header.Get("Set-Cookie"), rsp.StatusCode)
+	}
+
+	// A session that is never loaded is not saved.
+	handler = func(w http.ResponseWriter, r *http.Request) {}
+	if rsp := serve(""); rsp.Header.Get("Set-Cookie") != "" {
+		t.Error("Expected no cookie for an unused session")
+	}
+
+	// Changes after the response started are lost.
+	handler = func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "early")
+		session, _ := FromContext(r.Context())
+		session.Values["late"] = true
+	}
+	if rsp := serve(""); rsp.Header.Get("Set-Cookie") != "" {
+		t.Error("Expected no cookie once the response started")
+	}
+
+	// A cookie that fails to decode gets a new session.
+	handler = func(w http.ResponseWriter, r *http.Request) {
+		session, err := FromContext(r.Context())
+		if err == nil {
+			t.Error("Expected a decoding error")
+		}
+		session.Values["views"] = 1
+	}
+	if rsp := serve("session-key=garbage"); rsp.Header.Get("Set-Cookie") == "" {
+		t.Error("Expected a new session to be saved")
+	}
+
+	if _, err := FromContext(ctx); !errors.Is(err, ErrNoSessionMiddleware) {
+		t.Errorf("Expected ErrNoSessionMiddleware; Got %v", err)
+	}
+}
+
+func TestMiddlewareErrors(t *testing.T) {
+	store, err := NewRediStore([]string{setup()}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	store.SetKeyPrefix("middleware_test_")
+	store.SetMaxLength(64)
+	defer purgeSessions(t, store)
+
+	// A failed save replaces the response.
+	var writeErr error
+	srv := Middleware(store, "session-key")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, _ := FromContext(r.Context())
+		session.Values["big"] = strings.Repeat("x", 100)
+		_, writeErr = io.WriteString(w, "hello")
+	}))
+	rsp := httptest.NewRecorder()
+	srv.ServeHTTP(rsp, httptest.NewRequest("GET", "http://localhost/", nil))
+	if rsp.Code != http.StatusInternalServerError || strings.Contains(rsp.Body.String(), "hello") || writeErr == nil {
+		t.Errorf("Expected 500 and a write error; Got %d %q, %v", rsp.Code, rsp.Body.String(), writeErr)
+	}
+
+	// Writes from several goroutines all get the save error.
+	srv = Middleware(store, "session-key")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, _ := FromContext(r.Context())
+		session.Values["big"] = strings.Repeat("x", 100)
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		for i := range errs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, errs[i] = io.WriteString(w, "hello")
+			}()
+		}
+		wg.Wait()
+		for _, err := range errs {
+			if err == nil {
+				t.Error("Expected a write error")
+			}
+		}
+	}))
+	srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://localhost/", nil))
+
+	var handled error
+	srv = MiddlewareWithOptions(store, "session-key", MiddlewareOptions{
+		OnError: func(w http.ResponseWriter, r *http.Request, err error) {
+			handled = err
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, _ := FromContext(r.Context())
+		session.Values["big"] = strings.Repeat("x", 100)
+	}))
+	rsp = httptest.NewRecorder()
+	srv.ServeHTTP(rsp, httptest.NewRequest("GET", "http://localhost/", nil))
+	if rsp.Code != http.StatusRequestEntityTooLarge || handled == nil {
+		t.Errorf("Expected OnError to handle the failure; Got %d, %v", rsp.Code, handled)
+	}
+
+	// A session that failed to load is not overwritten.
+	down, _ := NewRediStoreWithExistingClient(redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1}), []byte("secret-key"))
+	defer func() {
+		if err := down.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	encoded, err := securecookie.EncodeMulti("session-key", "existing", store.Codecs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv = Middleware(down, "session-key")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, err := FromContext(r.Context())
+		if err == nil || session.ID != "existing" {
+			t.Errorf("Expected a load error for the existing session; Got %q, %v", session.ID, err)
+		}
+		session.Values["views"] = 1
+	}))
+	req := httptest.NewRequest("GET", "http://localhost/", nil)
+	req.AddCookie(&http.Cookie{Name: "session-key", Value: encoded})
+	rsp = httptest.NewRecorder()
+	srv.ServeHTTP(rsp, req)
+	if rsp.Code != http.StatusOK || rsp.Header().Get("Set-Cookie") != "" {
+		t.Errorf("Expected the session to be left alone; Got %d, %q", rsp.Code, rsp.Header().Get("Set-Cookie"))
+	}
+}
+
+// purgeSessions deletes every session of the store.
+func purgeSessions(t *testing.T, store *RediStore) {
+	t.Helper()
+	var ids []string
+	err := store.Scan(context.Background(), ScanOptions{}, func(rec *SessionRecord) error {
+		ids = append(ids, rec.ID)
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	for _, id := range ids {
+		store.DestroySession(context.Background(), id)
+	}
+}
+
+func TestMiddlewareSaveAck(t *testing.T) {
+	store, err := NewRediStore([]string{startServer(t)}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	// The embedded server has no replicas to acknowledge saves.
+	store.SetSaveAck(&SaveAck{})
+
+	var handled error
+	srv := MiddlewareWithOptions(store, "session-key", MiddlewareOptions{
+		OnError: func(w http.ResponseWriter, _ *http.Request, err error) {
+			handled = err
+			w.WriteHeader(http.StatusInternalServerError)
+		},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, _ := FromContext(r.Context())
+		session.Values["n"] = 1
+		io.WriteString(w, "ok")
+	}))
+	rsp := httptest.NewRecorder()
+	srv.ServeHTTP(rsp, httptest.NewRequest("GET", "http://localhost/", nil))
+	if rsp.Code != http.StatusOK || rsp.Body.String() != "ok" || handled != nil {
+		t.Errorf("Expected the response to go on; Got %d %q, %v", rsp.Code, rsp.Body.String(), handled)
+	}
+	if rsp.Header().Get("Set-Cookie") == "" {
+		t.Error("Expected the cookie to be set")
+	}
+}
@@ -0,0 +1,173 @@
+package redistore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// MigratingStore moves sessions from one RediStore to another without
+// downtime. It reads from the new store and falls back to the old one,
+// copying sessions found only in the old store to the new one. Writes and
+// deletes go to both stores, so either can serve traffic until the migration
+// is over.
+//
+// Both stores must use the same serializer, since sessions are copied as is.
+// Cookies are issued with the new store's codecs and options, and decoded
+// with the new store's codecs first, then the old one's.
+//
+// Once FallbackHits stops growing, or Remaining reports zero, every active
+// session lives in the new store and the old one can be retired.
+type MigratingStore struct {
+	From *RediStore // the old store
+	To   *RediStore // the new store
+
+	newHits      atomic.Int64
+	fallbackHits atomic.Int64
+	misses       atomic.Int64
+}
+
+// MigrationStats counts how MigratingStore served session loads.
+//
+// Fields:
+//
+//	NewHits: Sessions found in the new store.
+//	FallbackHits: Sessions found only in the old store and copied over.
+//	Misses: Sessions found in neither store.
+type MigrationStats struct {
+	NewHits      int64
+	FallbackHits int64
+	Misses       int64
+}
+
+// NewMigratingStore returns a MigratingStore moving sessions from one store
+// to another.
+func NewMigratingStore(from, to *RediStore) *MigratingStore {
+	return &MigratingStore{From: from, To: to}
+}
+
+// Stats returns the load counters accumulated since the store was created.
+func (m *MigratingStore) Stats() MigrationStats {
+	return MigrationStats{
+		NewHits:      m.newHits.Load(),
+		FallbackHits: m.fallbackHits.Load(),
+		Misses:       m.misses.Load(),
+	}
+}
+
+// Remaining counts the sessions of the old store that have not been copied
+// to the new one yet. It scans the whole old store.
+func (m *MigratingStore) Remaining(ctx context.Context) (int, error) {
+	n := 0
+	err := m.From.Scan(ctx, ScanOptions{}, func(rec *SessionRecord) error {
+		exists, err := m.To.Client.Exists(ctx, m.To.keyPrefix+rec.ID).Result()
+		if err != nil {
+			return err
+		}
+		if exists == 0 {
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Get returns a session for the given name after adding it to the registry.
+//
+// See gorilla/sessions FilesystemStore.Get().
+func (m *MigratingStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(m, name)
+}
+
+// New returns a session for the given name without adding it to the
+// registry, loading it from the new store or, failing that, the old one.
+//
+// See gorilla/sessions FilesystemStore.New().
+func (m *MigratingStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	var (
+		err error
+		ok  bool
+	)
+	session := sessions.NewSession(m, name)
+	// make a copy
+	options := *m.To.Options
+	session.Options = &options
+	session.IsNew = true
+	c, errCookie := r.Cookie(name)
+	if errCookie != nil {
+		return session, nil
+	}
+	codecs := append(append([]securecookie.Codec{}, m.To.Codecs...), m.From.Codecs...)
+	if err = securecookie.DecodeMulti(name, c.Value, &session.ID, codecs...); err != nil {
+		return session, err
+	}
+
+	if ok, err = m.To.load(session); err != nil {
+		return session, err
+	}
+	if ok {
+		m.newHits.Add(1)
+	} else if session.ID != "" { // a revoked session has its ID cleared
+		if ok, err = m.copyFromOld(r.Context(), session); err != nil {
+			return session, err
+		}
+	}
+	if !ok {
+		m.misses.Add(1)
+		return session, nil
+	}
+	session.IsNew = false
+	m.To.touch(r.Context(), r, session)
+	return session, nil
+}
+
+// copyFromOld loads session from the old store and copies it, with its TTL
+// and metadata, to the new store.
+func (m *MigratingStore) copyFromOld(ctx context.Context, session *sessions.Session) (bool, error) {
+	rec := &SessionRecord{ID: session.ID, Key: m.From.keyPrefix + session.ID}
+	found, err := m.From.loadRecord(ctx, rec, false)
+	if err != nil || !found {
+		return false, err
+	}
+	if err := m.From.serializer.Deserialize(rec.Raw, session); err != nil {
+		return false, err
+	}
+	tr := &TransferRecord{ID: rec.ID, TTLMillis: rec.TTL.Milliseconds(), Metadata: rec.Metadata, Payload: rec.Raw}
+	if err := m.To.importRecord(ctx, tr, false); err != nil {
+		return false, err
+	}
+	m.fallbackHits.Add(1)
+	return true, nil
+}
+
+// Save writes the session to both stores, or deletes it from both if its
+// MaxAge is negative, and sets the cookie using the new store's codecs.
+func (m *MigratingStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	prevID := session.ID
+	if err := m.To.Save(r, w, session); err != nil {
+		return err
+	}
+	if session.Options.MaxAge <= 0 {
+		_, err := m.From.deleteID(r.Context(), prevID)
+		return err
+	}
+	if prevID != "" && prevID != session.ID {
+		// The new store issued a new ID, drop the old one everywhere.
+		if _, err := m.From.deleteID(r.Context(), prevID); err != nil {
+			return err
+		}
+	}
+	return m.From.save(r, session)
+}
+
+// Delete removes the session from both stores and sets the cookie to expire.
+func (m *MigratingStore) Delete(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	id := session.ID
+	errNew := m.To.Delete(r, w, session)
+	_, errOld := m.From.deleteID(r.Context(), id)
+	return errors.Join(errNew, errOld)
+}
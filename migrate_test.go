@@ -0,0 +1,169 @@
+package redistore
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+func TestMigratingStore(t *testing.T) {
+	ctx := context.Background()
+	newStore := func(prefix string) *RediStore {
+		store, err := NewRediStore([]string{setup()}, false, []byte("secret-key"))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		store.SetKeyPrefix(prefix)
+		return store
+	}
+	oldStore, nextStore := newStore("migrate_old_test_"), newStore("migrate_new_test_")
+	defer func() {
+		if err := oldStore.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	defer func() {
+		if err := nextStore.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+
+	// A session created before the migration lives in the old store only.
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, _ := oldStore.New(req, "session-key")
+	session.Values["foo"] = "bar"
+	rsp := httptest.NewRecorder()
+	if err := oldStore.Save(req, rsp, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	cookie := rsp.Header().Get("Set-Cookie")
+	id := session.ID
+	defer oldStore.DestroySession(ctx, id)
+	defer nextStore.DestroySession(ctx, id)
+
+	m := NewMigratingStore(oldStore, nextStore)
+	if n, err := m.Remaining(ctx); err != nil || n != 1 {
+		t.Fatalf("Expected 1 remaining session; Got %d, %v", n, err)
+	}
+
+	load := func() *sessions.Session {
+		t.Helper()
+		req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+		req.Header.Add("Cookie", cookie)
+		session, err := m.New(req, "session-key")
+		if err != nil {
+			t.Fatalf("Error getting session: %v", err)
+		}
+		return session
+	}
+
+	session = load()
+	if session.IsNew || session.Values["foo"] != "bar" {
+		t.Fatalf("Expected session from the old store; Got %+v", session)
+	}
+	if stats := m.Stats(); stats.FallbackHits != 1 || stats.NewHits != 0 {
+		t.Errorf("Expected a fallback hit; Got %+v", stats)
+	}
+	if rec, err := nextStore.LookupSession(ctx, id); err != nil || rec.TTL <= 0 {
+		t.Errorf("Expected session to be copied with its TTL; Got %+v, %v", rec, err)
+	}
+	if n, _ := m.Remaining(ctx); n != 0 {
+		t.Errorf("Expected no remaining sessions; Got %d", n)
+	}
+
+	// Writes reach both stores.
+	session.Values["foo"] = "baz"
+	if err := m.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	for _, store := range []*RediStore{oldStore, nextStore} {
+		if rec, err := store.LookupSession(ctx, id); err != nil || rec.Values["foo"] != "baz" {
+			t.Errorf("Expected updated session in %s; Got %+v, %v", store.keyPrefix, rec, err)
+		}
+	}
+
+	if session = load(); session.IsNew || session.Values["foo"] != "baz" {
+		t.Errorf("Expected session from the new store; Got %+v", session)
+	}
+	if stats := m.Stats(); stats.NewHits != 1 || stats.FallbackHits != 1 {
+		t.Errorf("Expected a new store hit; Got %+v", stats)
+	}
+
+	// Deletes reach both stores.
+	session.Options.MaxAge = -1
+	if err := m.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error deleting session: %v", err)
+	}
+	for _, store := range []*RediStore{oldStore, nextStore} {
+		if _, err := store.LookupSession(ctx, id); err != ErrSessionNotFound {
+			t.Errorf("Expected session to be deleted from %s; Got %v", store.keyPrefix, err)
+		}
+	}
+	if session = load(); !session.IsNew {
+		t.Error("Expected deleted session to be new")
+	}
+	if stats := m.Stats(); stats.Misses != 1 {
+		t.Errorf("Expected a miss; Got %+v", stats)
+	}
+}
+
+func TestMigratingStoreTouch(t *testing.T) {
+	ctx := context.Background()
+	newStore := func(prefix string) *RediStore {
+		store, err := NewRediStore([]string{setup()}, false, []byte("secret-key"))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		store.SetKeyPrefix(prefix)
+		return store
+	}
+	oldStore, nextStore := newStore("migrate_old_test_"), newStore("migrate_new_test_")
+	defer func() {
+		if err := oldStore.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	defer func() {
+		if err := nextStore.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	nextStore.SetUserIDFunc(UserIDFromValue("user_id"))
+	nextStore.SetMaxUserSessions(2, EvictLeastRecentlyUsed)
+	nextStore.SetSessionMetadata(true)
+	defer nextStore.DestroyUserSessions(ctx, "fay")
+
+	session := saveUserSession(t, nextStore, "fay")
+	encoded, err := securecookie.EncodeMulti("session-key", session.ID, nextStore.Codecs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lru := nextStore.userLRUKey(idTag(session.ID))
+	saved, err := nextStore.Client.ZScore(ctx, lru, session.ID).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Millisecond)
+
+	// A failed last access update does not fail the load, and the LRU index
+	// is still refreshed.
+	hook := &outageHook{}
+	nextStore.Client.AddHook(hook)
+	failScripts(hook, readOnlyError{})
+	defer hook.set(nil)
+	m := NewMigratingStore(oldStore, nextStore)
+	req := httptest.NewRequest("GET", "http://localhost/", nil)
+	req.AddCookie(&http.Cookie{Name: "session-key", Value: encoded})
+	if loaded, err := m.New(req, "session-key"); err != nil || loaded.IsNew {
+		t.Fatalf("Expected the saved session; Got %v", err)
+	}
+	if loaded, err := nextStore.Client.ZScore(ctx, lru, session.ID).Result(); err != nil || loaded <= saved {
+		t.Errorf("Expected the LRU score to be refreshed; Got %v, %v", loaded, err)
+	}
+}
@@ -0,0 +1,513 @@
+package redistore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/sessions"
+)
+
+// PHPFormat selects the PHP session.serialize_handler a PHPSessionSerializer
+// reads and writes.
+type PHPFormat int
+
+const (
+	// PHPFormatPHP is PHP's default "php" handler, which writes each
+	// variable as name|value, e.g. `user|s:6:"gopher";visits|i:3;`.
+	PHPFormatPHP PHPFormat = iota
+	// PHPFormatSerialize is the "php_serialize" handler, which writes the
+	// whole session as one serialized array.
+	PHPFormatSerialize
+)
+
+// PHPSessionSerializer reads and writes sessions in the format of PHP's
+// session extension, so Go and PHP applications can share sessions. phpredis
+// stores them under the "PHPREDIS_SESSION:" key prefix, and PHP sends the
+// session ID unencoded, so a store sharing sessions with PHP is set up as
+//
+//	store.SetSerializer(redistore.PHPSessionSerializer{})
+//	store.SetKeyPrefix("PHPREDIS_SESSION:")
+//	store.Codecs = []securecookie.Codec{redistore.PlainIDCodec{}}
+//
+// and used with the session name "PHPSESSID".
+//
+// Null, booleans, integers, floats, strings and arrays are supported. PHP
+// arrays whose keys are 0 to n-1 in order load as []interface{}, other arrays
+// as map[string]interface{}. Integers load as int and floats as float64.
+// Objects load as PHPObject and are written back unchanged. References fail
+// to load. Maps are written with sorted keys.
+type PHPSessionSerializer struct {
+	Format PHPFormat
+}
+
+// PHPObject is a serialized PHP object, such as the validation errors a PHP
+// framework flashes to the session. Go cannot represent it, so it is kept in
+// its serialized form and written back as is.
+//
+// Fields:
+//
+//	Class: The PHP class name.
+//	Raw: The serialized object, starting with "O:" or "C:".
+type PHPObject struct {
+	Class string
+	Raw   []byte
+}
+
+// Serialize encodes the session values in the configured PHP format. Keys
+// must be strings, and with the php handler must not contain '|'.
+func (s PHPSessionSerializer) Serialize(ss *sessions.Session) ([]byte, error) {
+	keys := make([]string, 0, len(ss.Values))
+	for k := range ss.Values {
+		ks, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("redistore: non-string key value, cannot serialize session to PHP: %v", k)
+		}
+		if s.Format == PHPFormatPHP && strings.ContainsRune(ks, '|') {
+			return nil, fmt.Errorf("redistore: key %q contains '|', cannot serialize session to PHP", ks)
+		}
+		keys = append(keys, ks)
+	}
+	sort.Strings(keys)
+
+	buf := new(bytes.Buffer)
+	if s.Format == PHPFormatSerialize {
+		fmt.Fprintf(buf, "a:%d:{", len(keys))
+	}
+	for _, k := range keys {
+		if s.Format == PHPFormatSerialize {
+			writePHPKey(buf, k)
+		} else {
+			buf.WriteString(k)
+			buf.WriteByte('|')
+		}
+		if err := writePHP(buf, ss.Values[k]); err != nil {
+			return nil, fmt.Errorf("redistore: session key %q: %w", k, err)
+		}
+	}
+	if s.Format == PHPFormatSerialize {
+		buf.WriteByte('}')
+	}
+	return buf.Bytes(), nil
+}
+
+// Deserialize decodes session data written by PHP in the configured format
+// into the session's Values.
+func (s PHPSessionSerializer) Deserialize(d []byte, ss *sessions.Session) error {
+	dec := &phpDecoder{b: d}
+	if s.Format == PHPFormatSerialize {
+		v, err := dec.value()
+		if err != nil {
+			return err
+		}
+		if err := dec.end(); err != nil {
+			return err
+		}
+		switch m := v.(type) {
+		case map[string]interface{}:
+			for k, v := range m {
+				ss.Values[k] = v
+			}
+		case []interface{}:
+			// Only an empty session, PHP drops numeric keys from $_SESSION.
+			for i, v := range m {
+				ss.Values[strconv.Itoa(i)] = v
+			}
+		default:
+			return fmt.Errorf("redistore: PHP session data is a %T, not an array", v)
+		}
+		return nil
+	}
+
+	for dec.pos < len(dec.b) {
+		i := bytes.IndexByte(dec.b[dec.pos:], '|')
+		if i < 0 {
+			return dec.errorf("missing '|' after variable name")
+		}
+		name := string(dec.b[dec.pos : dec.pos+i])
+		dec.pos += i + 1
+		v, err := dec.value()
+		if err != nil {
+			return err
+		}
+		ss.Values[name] = v
+	}
+	return nil
+}
+
+// writePHP appends the PHP serialize representation of v to buf.
+func writePHP(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("N;")
+	case bool:
+		if v {
+			buf.WriteString("b:1;")
+		} else {
+			buf.WriteString("b:0;")
+		}
+	case string:
+		writePHPString(buf, v)
+	case []byte:
+		writePHPString(buf, string(v))
+	case float32:
+		writePHPFloat(buf, float64(v))
+	case float64:
+		writePHPFloat(buf, v)
+	case PHPObject:
+		buf.Write(v.Raw)
+	case *PHPObject:
+		buf.Write(v.Raw)
+	default:
+		return writePHPReflect(buf, reflect.ValueOf(v))
+	}
+	return nil
+}
+
+// writePHPReflect handles the integer, slice and map kinds of writePHP.
+func writePHPReflect(buf *bytes.Buffer, rv reflect.Value) error {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		fmt.Fprintf(buf, "i:%d;", rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return fmt.Errorf("integer %d overflows a PHP integer", rv.Uint())
+		}
+		fmt.Fprintf(buf, "i:%d;", rv.Uint())
+	case reflect.Slice, reflect.Array:
+		fmt.Fprintf(buf, "a:%d:{", rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			fmt.Fprintf(buf, "i:%d;", i)
+			if err := writePHP(buf, rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case reflect.Map:
+		keys := make([]string, 0, rv.Len())
+		values := make(map[string]reflect.Value, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			k := iter.Key()
+			if k.Kind() == reflect.Interface {
+				k = k.Elem()
+			}
+			var ks string
+			switch k.Kind() {
+			case reflect.String:
+				ks = k.String()
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				ks = strconv.FormatInt(k.Int(), 10)
+			default:
+				return fmt.Errorf("map key %v is neither a string nor an integer", k)
+			}
+			keys = append(keys, ks)
+			values[ks] = iter.Value()
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(buf, "a:%d:{", len(keys))
+		for _, k := range keys {
+			writePHPKey(buf, k)
+			if err := writePHP(buf, values[k].Interface()); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("cannot serialize %T to PHP", rv.Interface())
+	}
+	return nil
+}
+
+func writePHPString(buf *bytes.Buffer, s string) {
+	fmt.Fprintf(buf, "s:%d:\"%s\";", len(s), s)
+}
+
+func writePHPFloat(buf *bytes.Buffer, f float64) {
+	switch {
+	case math.IsInf(f, 1):
+		buf.WriteString("d:INF;")
+	case math.IsInf(f, -1):
+		buf.WriteString("d:-INF;")
+	case math.IsNaN(f):
+		buf.WriteString("d:NAN;")
+	default:
+		buf.WriteString("d:" + strconv.FormatFloat(f, 'G', -1, 64) + ";")
+	}
+}
+
+// writePHPKey writes an array key, as an integer if PHP would store it as one.
+func writePHPKey(buf *bytes.Buffer, k string) {
+	if n, err := strconv.ParseInt(k, 10, 64); err == nil && strconv.FormatInt(n, 10) == k {
+		fmt.Fprintf(buf, "i:%d;", n)
+		return
+	}
+	writePHPString(buf, k)
+}
+
+// phpDecoder parses PHP serialize data.
+type phpDecoder struct {
+	b   []byte
+	pos int
+}
+
+func (d *phpDecoder) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("redistore: invalid PHP session data at offset %d: %s", d.pos, fmt.Sprintf(format, args...))
+}
+
+// end returns an error if there is data left after the parsed value.
+func (d *phpDecoder) end() error {
+	if d.pos != len(d.b) {
+		return d.errorf("unexpected data after value")
+	}
+	return nil
+}
+
+// expect consumes the byte c.
+func (d *phpDecoder) expect(c byte) error {
+	if d.pos >= len(d.b) || d.b[d.pos] != c {
+		return d.errorf("expected %q", c)
+	}
+	d.pos++
+	return nil
+}
+
+// until consumes and returns the bytes up to the next c, consuming c too.
+func (d *phpDecoder) until(c byte) (string, error) {
+	i := bytes.IndexByte(d.b[d.pos:], c)
+	if i < 0 {
+		return "", d.errorf("expected %q", c)
+	}
+	s := string(d.b[d.pos : d.pos+i])
+	d.pos += i + 1
+	return s, nil
+}
+
+// value parses a single serialized value.
+func (d *phpDecoder) value() (interface{}, error) {
+	if d.pos+1 >= len(d.b) {
+		return nil, d.errorf("unexpected end of data")
+	}
+	start, kind := d.pos, d.b[d.pos]
+	if kind == 'N' {
+		d.pos++
+		return nil, d.expect(';')
+	}
+	d.pos++
+	if err := d.expect(':'); err != nil {
+		return nil, err
+	}
+	switch kind {
+	case 'b':
+		s, err := d.until(';')
+		if err != nil {
+			return nil, err
+		}
+		if s != "0" && s != "1" {
+			return nil, d.errorf("invalid boolean %q", s)
+		}
+		return s == "1", nil
+	case 'i':
+		s, err := d.until(';')
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, d.errorf("invalid integer %q", s)
+		}
+		return n, nil
+	case 'd':
+		s, err := d.until(';')
+		if err != nil {
+			return nil, err
+		}
+		switch s {
+		case "INF":
+			return math.Inf(1), nil
+		case "-INF":
+			return math.Inf(-1), nil
+		case "NAN":
+			return math.NaN(), nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, d.errorf("invalid float %q", s)
+		}
+		return f, nil
+	case 's':
+		return d.str()
+	case 'a':
+		return d.array()
+	case 'O', 'C':
+		return d.object(start, kind)
+	default:
+		return nil, d.errorf("unsupported type %q", kind)
+	}
+}
+
+// str parses the remainder of a string after "s:".
+func (d *phpDecoder) str() (string, error) {
+	s, err := d.until(':')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || d.pos+n+3 > len(d.b) {
+		return "", d.errorf("invalid string length %q", s)
+	}
+	if err := d.expect('"'); err != nil {
+		return "", err
+	}
+	v := string(d.b[d.pos : d.pos+n])
+	d.pos += n
+	if err := d.expect('"'); err != nil {
+		return "", err
+	}
+	return v, d.expect(';')
+}
+
+// array parses the remainder of an array after "a:".
+func (d *phpDecoder) array() (interface{}, error) {
+	s, err := d.until(':')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > len(d.b)-d.pos {
+		return nil, d.errorf("invalid array length %q", s)
+	}
+	if err := d.expect('{'); err != nil {
+		return nil, err
+	}
+	keys := make([]string, n)
+	values := make([]interface{}, n)
+	list := true
+	for i := 0; i < n; i++ {
+		k, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		switch k := k.(type) {
+		case int:
+			keys[i] = strconv.Itoa(k)
+			list = list && k == i
+		case string:
+			keys[i] = k
+			list = false
+		default:
+			return nil, d.errorf("invalid array key %v", k)
+		}
+		if values[i], err = d.value(); err != nil {
+			return nil, err
+		}
+	}
+	if err := d.expect('}'); err != nil {
+		return nil, err
+	}
+	if list {
+		return values, nil
+	}
+	m := make(map[string]interface{}, n)
+	for i, k := range keys {
+		m[k] = values[i]
+	}
+	return m, nil
+}
+
+// object parses the remainder of an object after "O:" or "C:", keeping it
+// in its serialized form. Objects list their properties like an array;
+// custom serialized ones ("C:") are followed by a string of given length.
+func (d *phpDecoder) object(start int, kind byte) (*PHPObject, error) {
+	s, err := d.until(':')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || d.pos+n+2 > len(d.b) {
+		return nil, d.errorf("invalid class name length %q", s)
+	}
+	if err := d.expect('"'); err != nil {
+		return nil, err
+	}
+	class := string(d.b[d.pos : d.pos+n])
+	d.pos += n
+	if err := d.expect('"'); err != nil {
+		return nil, err
+	}
+	if err := d.expect(':'); err != nil {
+		return nil, err
+	}
+	if s, err = d.until(':'); err != nil {
+		return nil, err
+	}
+	if n, err = strconv.Atoi(s); err != nil || n < 0 || n > len(d.b)-d.pos {
+		return nil, d.errorf("invalid object length %q", s)
+	}
+	if err := d.expect('{'); err != nil {
+		return nil, err
+	}
+	if kind == 'C' {
+		d.pos += n
+	} else {
+		for i := 0; i < 2*n; i++ {
+			if _, err := d.value(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := d.expect('}'); err != nil {
+		return nil, err
+	}
+	return &PHPObject{Class: class, Raw: append([]byte(nil), d.b[start:d.pos]...)}, nil
+}
+
+// PlainIDCodec is a securecookie.Codec that sends the session ID as is, the
+// way PHP and most other frameworks do, for sharing sessions with them. The
+// cookie is neither signed nor encrypted, so the session ID alone must be
+// unguessable. Decode only accepts IDs made of letters, digits, ',', '-' and
+// the braces of hash tags, which covers both PHP's IDs and this package's.
+type PlainIDCodec struct{}
+
+// errInvalidPlainID is returned by PlainIDCodec for malformed session IDs.
+var errInvalidPlainID = errors.New("redistore: invalid session ID")
+
+// Encode returns value, which must be a session ID string.
+func (PlainIDCodec) Encode(_ string, value interface{}) (string, error) {
+	id, ok := value.(string)
+	if !ok || !validPlainID(id) {
+		return "", errInvalidPlainID
+	}
+	return id, nil
+}
+
+// Decode stores the session ID in value into dst, which must be a *string.
+func (PlainIDCodec) Decode(_ string, value string, dst interface{}) error {
+	p, ok := dst.(*string)
+	if !ok || !validPlainID(value) {
+		return errInvalidPlainID
+	}
+	*p = value
+	return nil
+}
+
+// validPlainID reports whether id looks like a session ID.
+func validPlainID(id string) bool {
+	if id == "" || len(id) > 256 {
+		return false
+	}
+	for _, c := range []byte(id) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == ',' || c == '-' || c == '{' || c == '}':
+		default:
+			return false
+		}
+	}
+	return true
+}
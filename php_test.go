@@ -0,0 +1,214 @@
+package redistore
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// phpValues is the session written by the PHP fixtures below.
+var phpValues = map[interface{}]interface{}{
+	"user":    "gopher",
+	"visits":  3,
+	"ratio":   0.5,
+	"admin":   true,
+	"nothing": nil,
+	"note":    `héllo ";|`,
+	"tags":    []interface{}{"a", "b"},
+	"prefs": map[string]interface{}{
+		"theme": "dark",
+		"sizes": map[string]interface{}{"10": "ten"},
+	},
+}
+
+// Written by PHP with session.serialize_handler = php and php_serialize.
+const (
+	phpFixture = `admin|b:1;note|s:10:"héllo ";|";nothing|N;` +
+		`prefs|a:2:{s:5:"sizes";a:1:{i:10;s:3:"ten";}s:5:"theme";s:4:"dark";}` +
+		`ratio|d:0.5;tags|a:2:{i:0;s:1:"a";i:1;s:1:"b";}user|s:6:"gopher";visits|i:3;`
+	phpSerializeFixture = `a:8:{s:5:"admin";b:1;s:4:"note";s:10:"héllo ";|";s:7:"nothing";N;` +
+		`s:5:"prefs";a:2:{s:5:"sizes";a:1:{i:10;s:3:"ten";}s:5:"theme";s:4:"dark";}` +
+		`s:5:"ratio";d:0.5;s:4:"tags";a:2:{i:0;s:1:"a";i:1;s:1:"b";}s:4:"user";s:6:"gopher";s:6:"visits";i:3;}`
+)
+
+func TestPHPSessionSerializer(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		format  PHPFormat
+		fixture string
+	}{
+		{"php", PHPFormatPHP, phpFixture},
+		{"php_serialize", PHPFormatSerialize, phpSerializeFixture},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := PHPSessionSerializer{Format: tc.format}
+			session := sessions.NewSession(nil, "PHPSESSID")
+			if err := s.Deserialize([]byte(tc.fixture), session); err != nil {
+				t.Fatalf("Error deserializing: %v", err)
+			}
+			if !reflect.DeepEqual(session.Values, phpValues) {
+				t.Errorf("Expected %v; Got %v", phpValues, session.Values)
+			}
+
+			b, err := s.Serialize(session)
+			if err != nil {
+				t.Fatalf("Error serializing: %v", err)
+			}
+			if string(b) != tc.fixture {
+				t.Errorf("Expected %s; Got %s", tc.fixture, b)
+			}
+		})
+	}
+}
+
+func TestPHPSessionSerializerTypes(t *testing.T) {
+	s := PHPSessionSerializer{}
+	session := sessions.NewSession(nil, "PHPSESSID")
+	session.Values["int64"] = int64(-7)
+	session.Values["uint8"] = uint8(7)
+	session.Values["float"] = 1e21
+	session.Values["inf"] = math.Inf(-1)
+	session.Values["bytes"] = []byte("raw")
+	session.Values["strings"] = []string{"x"}
+	session.Values["empty"] = []interface{}{}
+	session.Values["keys"] = map[interface{}]interface{}{"0": "zero", "07": "seven"}
+	b, err := s.Serialize(session)
+	if err != nil {
+		t.Fatalf("Error serializing: %v", err)
+	}
+	expected := `bytes|s:3:"raw";empty|a:0:{}float|d:1E+21;inf|d:-INF;int64|i:-7;` +
+		`keys|a:2:{i:0;s:4:"zero";s:2:"07";s:5:"seven";}strings|a:1:{i:0;s:1:"x";}uint8|i:7;`
+	if string(b) != expected {
+		t.Errorf("Expected %s; Got %s", expected, b)
+	}
+
+	for _, v := range []interface{}{time.Now(), struct{}{}, map[bool]int{true: 1}} {
+		session.Values = map[interface{}]interface{}{"bad": v}
+		if _, err := s.Serialize(session); err == nil {
+			t.Errorf("Expected an error serializing %T", v)
+		}
+	}
+	session.Values = map[interface{}]interface{}{"a|b": 1}
+	if _, err := s.Serialize(session); err == nil {
+		t.Error("Expected an error for a key containing '|'")
+	}
+	session.Values = map[interface{}]interface{}{1: 1}
+	if _, err := s.Serialize(session); err == nil {
+		t.Error("Expected an error for a non-string key")
+	}
+}
+
+func TestPHPSessionSerializerInvalid(t *testing.T) {
+	for _, d := range []string{
+		`user|s:7:"gopher";`,
+		`user|s:6:"gopher"`,
+		`user|i:x;`,
+		`user|b:2;`,
+		`user|O:8:"stdClass":1:{s:1:"a";}`,
+		`user|a:2:{i:0;s:1:"a";}`,
+		`user|R:1;`,
+		`user`,
+	} {
+		session := sessions.NewSession(nil, "PHPSESSID")
+		if err := (PHPSessionSerializer{}).Deserialize([]byte(d), session); err == nil {
+			t.Errorf("Expected an error for %s", d)
+		}
+	}
+	session := sessions.NewSession(nil, "PHPSESSID")
+	if err := (PHPSessionSerializer{Format: PHPFormatSerialize}).Deserialize([]byte(`a:0:{}x`), session); err == nil {
+		t.Error("Expected an error for trailing data")
+	}
+}
+
+func TestPHPSessionSerializerObjects(t *testing.T) {
+	s := PHPSessionSerializer{}
+	d := `errors|O:8:"stdClass":1:{s:4:"\0*\0a";a:1:{i:0;s:1:"x";}}n|i:1;obj|C:11:"ArrayObject":4:{x:i0}`
+	d = strings.ReplaceAll(d, `\0`, "\x00")
+	session := sessions.NewSession(nil, "PHPSESSID")
+	if err := s.Deserialize([]byte(d), session); err != nil {
+		t.Fatalf("Error deserializing: %v", err)
+	}
+	if o, ok := session.Values["errors"].(*PHPObject); !ok || o.Class != "stdClass" {
+		t.Errorf("Expected a stdClass object; Got %#v", session.Values["errors"])
+	}
+	if o, ok := session.Values["obj"].(*PHPObject); !ok || o.Class != "ArrayObject" {
+		t.Errorf("Expected an ArrayObject; Got %#v", session.Values["obj"])
+	}
+	b, err := s.Serialize(session)
+	if err != nil || string(b) != d {
+		t.Errorf("Expected objects to be written back unchanged; Got %q, %v", b, err)
+	}
+}
+
+func TestPlainIDCodec(t *testing.T) {
+	var id string
+	for _, v := range []string{"", "abc:meta", "a b", "a\"b"} {
+		if err := (PlainIDCodec{}).Decode("PHPSESSID", v, &id); err == nil {
+			t.Errorf("Expected %q to be rejected", v)
+		}
+	}
+	for _, v := range []string{"3h0hmut8ffl1p4rqhh6jlbjvbd", "{0a1b}ABC-2,3"} {
+		if err := (PlainIDCodec{}).Decode("PHPSESSID", v, &id); err != nil || id != v {
+			t.Errorf("Expected %q to be accepted; Got %q, %v", v, id, err)
+		}
+	}
+}
+
+func TestPHPSessionSharing(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewRediStore([]string{setup()}, false)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	store.SetSerializer(PHPSessionSerializer{})
+	store.SetKeyPrefix("PHPREDIS_SESSION:")
+	store.Codecs = []securecookie.Codec{PlainIDCodec{}}
+
+	// A session created by a PHP page.
+	const id = "3h0hmut8ffl1p4rqhh6jlbjvbd"
+	if err := store.Client.Set(ctx, "PHPREDIS_SESSION:"+id, phpFixture, time.Minute).Err(); err != nil {
+		t.Fatal(err)
+	}
+	defer store.DestroySession(ctx, id)
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.AddCookie(&http.Cookie{Name: "PHPSESSID", Value: id})
+	session, err := store.Get(req, "PHPSESSID")
+	if err != nil || session.IsNew {
+		t.Fatalf("Expected the PHP session; Got new %v, %v", session.IsNew, err)
+	}
+	if session.Values["user"] != "gopher" || session.Values["visits"] != 3 {
+		t.Errorf("Unexpected values %v", session.Values)
+	}
+
+	session.Values["visits"] = 4
+	rsp := httptest.NewRecorder()
+	if err := store.Save(req, rsp, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	if c := rsp.Result().Cookies(); len(c) != 1 || c[0].Value != id {
+		t.Errorf("Expected plain cookie %s; Got %v", id, c)
+	}
+	raw, err := store.Client.Get(ctx, "PHPREDIS_SESSION:"+id).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	session = sessions.NewSession(nil, "PHPSESSID")
+	if err := (PHPSessionSerializer{}).Deserialize([]byte(raw), session); err != nil || session.Values["visits"] != 4 {
+		t.Errorf("Expected visits to be updated for PHP; Got %s, %v", raw, err)
+	}
+}
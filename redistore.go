@@ -19,6 +19,7 @@ import (
 	"net/http"
 
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/securecookie"
@@ -147,14 +148,37 @@ func (s GobSerializer) Deserialize(d []byte, ss *sessions.Session) error {
 //	maxLength: Maximum length of session data.
 //	keyPrefix: Prefix to be added to all Redis keys used by this store.
 //	serializer: Serializer used to encode and decode session data.
+//	userIDFunc: Extracts the owning user of a session for the user index.
+//	maxUserSessions: Maximum number of live sessions per user, 0 for no limit.
+//	evictionPolicy: What to do when a user would exceed maxUserSessions.
+//	revocation: Whether issue times are recorded and checked against revocation epochs.
+//	metadata: Whether name, access times, IP and user agent are recorded per session.
+//	breaker: The circuit breaker set with SetCircuitBreaker, if any.
+//	retry: The retry policy set with SetRetryPolicy, if any.
+//	replica: Routes reads to replicas when set with SetReadReplica.
+//	ack: The replica acknowledgment saves wait for, set with SetSaveAck.
+//	cache: The session cache enabled with SetCache, if any.
+//	loads: Coalesces concurrent loads of the same session.
 type RediStore struct {
-	Client        redis.UniversalClient
-	Codecs        []securecookie.Codec
-	Options       *sessions.Options // default configuration
-	DefaultMaxAge int               // default Redis TTL for a MaxAge == 0 session
-	maxLength     int
-	keyPrefix     string
-	serializer    SessionSerializer
+	Client          redis.UniversalClient
+	Codecs          []securecookie.Codec
+	Options         *sessions.Options // default configuration
+	DefaultMaxAge   int               // default Redis TTL for a MaxAge == 0 session
+	maxLength       int
+	keyPrefix       string
+	serializer      SessionSerializer
+	userIDFunc      UserIDFunc
+	maxUserSessions int
+	evictionPolicy  EvictionPolicy
+	revocation      bool
+	metadata        bool
+	breaker         *circuitBreaker
+	retry           *RetryPolicy
+	replica         *replicaRouter
+	ack             *SaveAck
+	cache           *sessionCache
+	loads           flightGroup
+	saveAll         atomic.Bool // whether SaveAll has been called
 }
 
 // SetMaxLength sets RediStore.maxLength if the `l` argument is greater or equal 0
@@ -257,11 +281,11 @@ func newUniversalRedisClient(redisURLs []string, useTLS bool) (redis.UniversalCl
 	return client, nil
 }
 
-// NewRediStoreWithPool creates a new RediStore instance using the provided
-// Redis connection pool and key pairs for secure cookie encoding.
+// NewRediStoreWithExistingClient creates a new RediStore instance using the
+// provided Redis client and key pairs for secure cookie encoding.
 //
 // Parameters:
-//   - pool: A Redis connection pool.
+//   - client: A Redis client.
 //   - keyPairs: Variadic parameter for secure cookie encoding key pairs.
 //
 // Returns:
@@ -291,20 +315,35 @@ func NewRediStoreWithExistingClient(client redis.UniversalClient, keyPairs ...[]
 
 // Close closes the underlying *redis.Pool
 func (s *RediStore) Close() error {
-	return s.Client.Close()
+	var err error
+	if s.cache != nil {
+		err = s.cache.close()
+	}
+	return errors.Join(err, s.Client.Close())
 }
 
 // Get returns a session for the given name after adding it to the registry.
+// The session is also remembered for SaveAll.
 //
 // See gorilla/sessions FilesystemStore.Get().
 func (s *RediStore) Get(r *http.Request, name string) (*sessions.Session, error) {
-	return sessions.GetRegistry(r).Get(s, name)
+	session, err := sessions.GetRegistry(r).Get(s, name)
+	s.register(r, session, err)
+	return session, err
 }
 
 // New returns a session for the given name without adding it to the registry.
 //
 // See gorilla/sessions FilesystemStore.New().
 func (s *RediStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	if s.breaker != nil {
+		return s.breaker.newSession(r, name)
+	}
+	return s.newSession(r, name)
+}
+
+// newSession is New without the circuit breaker.
+func (s *RediStore) newSession(r *http.Request, name string) (*sessions.Session, error) {
 	var (
 		err error
 		ok  bool
@@ -320,12 +359,44 @@ func (s *RediStore) New(r *http.Request, name string) (*sessions.Session, error)
 			ok, err = s.load(session)
 			session.IsNew = err != nil || !ok // not new if no error and data available
 		}
+		if err == nil && ok {
+			s.touch(context.Background(), r, session)
+		}
 	}
 	return session, err
 }
 
-// Save adds a single session to the response.
-func (s *RediStore) Save(_ *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+// touch records that a session was loaded in the LRU index and the metadata.
+// They are bookkeeping, kept up to date on a best effort basis: failing to
+// write them, as on a replica not yet promoted, must not fail the load. Nothing
+// is written while the circuit breaker keeps the store read-only.
+func (s *RediStore) touch(ctx context.Context, r *http.Request, session *sessions.Session) {
+	if !s.breaker.loadsWrite() {
+		return
+	}
+	_ = s.touchLRU(ctx, session)
+	if s.metadata {
+		_ = s.touchMeta(ctx, r, session)
+	}
+}
+
+// Save adds a single session to the response. A session got through Get
+// counts as loaded again for SaveAll once saved.
+func (s *RediStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	var err error
+	if s.breaker != nil {
+		err = s.breaker.saveSession(r, w, session)
+	} else {
+		err = s.saveSession(r, w, session)
+	}
+	if err == nil {
+		s.resnapshot(r, session)
+	}
+	return err
+}
+
+// saveSession is Save without the circuit breaker.
+func (s *RediStore) saveSession(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
 	// Marked for deletion.
 	if session.Options.MaxAge <= 0 {
 		if err := s.delete(session); err != nil {
@@ -333,18 +404,25 @@ func (s *RediStore) Save(_ *http.Request, w http.ResponseWriter, session *sessio
 		}
 		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
 	} else {
-		// Build an alphanumeric key for the redis store.
-		if session.ID == "" {
-			session.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+		if s.userIDFunc != nil {
+			if err := s.retagID(session); err != nil {
+				return err
+			}
+		} else if session.ID == "" {
+			session.ID = newSessionID()
 		}
-		if err := s.save(session); err != nil {
-			return err
+		// The cookie is set even if too few replicas acknowledged the save.
+		var ackErr *AckError
+		saveErr := s.save(r, session)
+		if saveErr != nil && !errors.As(saveErr, &ackErr) {
+			return saveErr
 		}
 		encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
 		if err != nil {
 			return err
 		}
 		http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+		return saveErr
 	}
 	return nil
 }
@@ -353,8 +431,16 @@ func (s *RediStore) Save(_ *http.Request, w http.ResponseWriter, session *sessio
 //
 // WARNING: This method should be considered deprecated since it is not exposed via the gorilla/sessions interface.
 // Set session.Options.MaxAge = -1 and call Save instead. - July 18th, 2013
-func (s *RediStore) Delete(_ *http.Request, w http.ResponseWriter, session *sessions.Session) error {
-	if _, err := s.Client.Del(context.Background(), s.keyPrefix+session.ID).Result(); err != nil {
+func (s *RediStore) Delete(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if s.breaker != nil {
+		return s.breaker.deleteSession(r, w, session)
+	}
+	return s.deleteSession(r, w, session)
+}
+
+// deleteSession is Delete without the circuit breaker.
+func (s *RediStore) deleteSession(_ *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if err := s.delete(session); err != nil {
 		return err
 	}
 
@@ -369,6 +455,11 @@ func (s *RediStore) Delete(_ *http.Request, w http.ResponseWriter, session *sess
 	return nil
 }
 
+// newSessionID builds an alphanumeric key for the redis store.
+func newSessionID() string {
+	return strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+}
+
 // ping does an internal ping against a server to check if it is alive.
 func (s *RediStore) ping() (bool, error) {
 	data, err := s.Client.Ping(context.Background()).Result()
@@ -380,7 +471,7 @@ func (s *RediStore) ping() (bool, error) {
 }
 
 // save stores the session in redis.
-func (s *RediStore) save(session *sessions.Session) error {
+func (s *RediStore) save(r *http.Request, session *sessions.Session) error {
 	b, err := s.serializer.Serialize(session)
 	if err != nil {
 		return err
@@ -388,12 +479,49 @@ func (s *RediStore) save(session *sessions.Session) error {
 	if s.maxLength != 0 && len(b) > s.maxLength {
 		return errors.New("SessionStore: the value to store is too big")
 	}
+	// A failed save may still have been applied.
+	defer s.wrote(session.ID)
+	defer s.invalidate(context.Background(), session.ID)
+	return s.withRetry(OpSave, func() error { return s.store(r, session, b) })
+}
 
+// store writes the serialized session and its metadata.
+func (s *RediStore) store(r *http.Request, session *sessions.Session, b []byte) error {
+	var err error
+	ctx := context.Background()
+	ack := s.saveAck(r)
 	age := session.Options.MaxAge
 	if age == 0 {
 		age = s.DefaultMaxAge
 	}
-	_, err = s.Client.SetEx(context.Background(), s.keyPrefix+session.ID, b, time.Duration(age)*time.Second).Result()
+	if idTag(session.ID) != "" {
+		err = s.saveIndexed(ctx, session, b, age, ack)
+	} else if ack == nil {
+		_, err = s.Client.SetEx(ctx, s.keyPrefix+session.ID, b, time.Duration(age)*time.Second).Result()
+	} else {
+		var c redis.Cmdable
+		var wait *redis.Cmd
+		if c, err = s.ackClient(ctx, s.keyPrefix+session.ID); err != nil {
+			return err
+		}
+		if _, err = c.Pipelined(ctx, func(p redis.Pipeliner) error {
+			p.SetEx(ctx, s.keyPrefix+session.ID, b, time.Duration(age)*time.Second)
+			wait = ack.queue(ctx, p)
+			return nil
+		}); err == nil {
+			err = ack.check(wait)
+		}
+	}
+	// A session too few replicas acknowledged is stored all the same.
+	var ackErr *AckError
+	if err != nil && !errors.As(err, &ackErr) {
+		return err
+	}
+	if s.revocation || s.metadata {
+		if merr := s.writeMeta(ctx, r, session, age, ack); merr != nil {
+			return merr
+		}
+	}
 
 	return err
 }
@@ -401,23 +529,92 @@ func (s *RediStore) save(session *sessions.Session) error {
 // load reads the session from redis.
 // returns true if there is a sessoin data in DB
 func (s *RediStore) load(session *sessions.Session) (bool, error) {
-	data, err := s.Client.Get(context.Background(), s.keyPrefix+session.ID).Result()
+	var ok bool
+	err := s.withRetry(OpLoad, func() (err error) {
+		ok, err = s.fetch(session)
+		return err
+	})
+	return ok, err
+}
 
-	if err != nil && !errors.Is(err, redis.Nil) {
-		return false, err
-	}
-	if data == "" {
-		return false, nil // no data was associated with this key
+// fetch makes a single attempt at loading the session.
+func (s *RediStore) fetch(session *sessions.Session) (bool, error) {
+	data, ok := s.cache.get(session.ID)
+	if !ok {
+		var err error
+		var revoked bool
+		data, revoked, err = s.loads.do(session.ID, func() (string, bool, error) {
+			return s.read(session.ID)
+		})
+		if err != nil {
+			return false, err
+		}
+		if revoked {
+			session.ID = ""
+		}
+		if data == "" {
+			return false, nil // no data was associated with this key
+		}
 	}
 
 	return true, s.serializer.Deserialize([]byte(data), session)
 }
 
+// read reads the payload of the session with the given ID from redis,
+// caching it if the cache is enabled. It returns an empty payload if there is
+// no such session or it is revoked.
+func (s *RediStore) read(id string) (string, bool, error) {
+	ctx := context.Background()
+	token := s.cache.token()
+	if s.revocation {
+		data, revoked, err := s.loadUnrevoked(ctx, id)
+		if err == nil && data != "" {
+			s.cache.put(id, data, token)
+		}
+		return data, revoked, err
+	}
+	data, err := s.get(ctx, id)
+	if errors.Is(err, redis.Nil) {
+		return "", false, nil
+	}
+	if err == nil {
+		s.cache.put(id, data, token)
+	}
+	return data, false, err
+}
+
 // delete removes keys from redis if MaxAge<0
 func (s *RediStore) delete(session *sessions.Session) error {
-	if _, err := s.Client.Del(context.Background(), s.keyPrefix+session.ID).Result(); err != nil {
+	return s.deleteRetried(session.ID)
+}
+
+// deleteRetried removes the session stored under id under the retry policy.
+func (s *RediStore) deleteRetried(id string) error {
+	defer s.wrote(id)
+	return s.withRetry(OpDelete, func() error {
+		_, err := s.deleteID(context.Background(), id)
 		return err
+	})
+}
+
+// deleteID removes the session stored under id along with its metadata and
+// index entries, reporting whether the session existed.
+func (s *RediStore) deleteID(ctx context.Context, id string) (bool, error) {
+	defer s.invalidate(ctx, id)
+	if tag := idTag(id); tag != "" {
+		keys := []string{s.keyPrefix + id, s.userIndexKey(tag), s.userLRUKey(tag), s.metaKey(id)}
+		n, err := deleteIndexedScript.Run(ctx, s.Client, keys, id).Int()
+		return n > 0, err
+	}
+	// The session and its metadata may live on different cluster nodes.
+	var del *redis.IntCmd
+	if _, err := s.Client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		del = p.Del(ctx, s.keyPrefix+id)
+		p.Del(ctx, s.metaKey(id))
+		return nil
+	}); err != nil {
+		return false, err
 	}
 
-	return nil
+	return del.Val() > 0, nil
 }
@@ -12,6 +12,7 @@ import (
 	"testing"
 
 	"github.com/gorilla/sessions"
+	"github.com/poseidonphp/redistore/redistoretest/redisserver"
 )
 
 const (
@@ -26,6 +27,22 @@ func setup() string {
 	return addr
 }
 
+// startServer starts an embedded Redis server for the test and returns its
+// URL.
+func startServer(t *testing.T) string {
+	t.Helper()
+	srv, err := redisserver.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := srv.Close(); err != nil {
+			fmt.Printf("Error closing server: %v\n", err)
+		}
+	})
+	return srv.URL()
+}
+
 // ----------------------------------------------------------------------------
 // ResponseRecorder
 // ----------------------------------------------------------------------------
@@ -84,10 +101,10 @@ type FlashMessage struct {
 }
 
 func TestRediStore(t *testing.T) {
+	addr := startServer(t)
 	var cookies []string
 	var ok bool
 	t.Run("Round 1", func(t *testing.T) {
-		addr := setup()
 		store, err := NewRediStore([]string{addr}, false, []byte("secret-key"))
 		if err != nil {
 			t.Fatal(err.Error())
@@ -122,7 +139,6 @@ func TestRediStore(t *testing.T) {
 	})
 
 	t.Run("Round 2", func(t *testing.T) {
-		addr := setup()
 		store, err := NewRediStore([]string{addr}, false, []byte("secret-key"))
 		if err != nil {
 			t.Fatal(err.Error())
@@ -168,7 +184,6 @@ func TestRediStore(t *testing.T) {
 	})
 
 	t.Run("Round 3", func(t *testing.T) {
-		addr := setup()
 		store, err := NewRediStore([]string{addr}, false, []byte("secret-key"))
 		if err != nil {
 			t.Fatal(err.Error())
@@ -201,7 +216,6 @@ func TestRediStore(t *testing.T) {
 	})
 
 	t.Run("Round 4", func(t *testing.T) {
-		addr := setup()
 		store, err := NewRediStore([]string{addr}, false, []byte("secret-key"))
 		if err != nil {
 			t.Fatal(err.Error())
@@ -234,7 +248,6 @@ func TestRediStore(t *testing.T) {
 	})
 
 	t.Run("Round 6", func(t *testing.T) {
-		addr := setup()
 		store, err := NewRediStore([]string{addr}, false, []byte("secret-key"))
 		if err != nil {
 			t.Fatal(err.Error())
@@ -263,7 +276,6 @@ func TestRediStore(t *testing.T) {
 	})
 
 	t.Run("Round 7", func(t *testing.T) {
-		addr := setup()
 		store, err := NewRediStore([]string{addr}, false, []byte("secret-key"))
 		store.SetSerializer(JSONSerializer{})
 		if err != nil {
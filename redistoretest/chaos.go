@@ -0,0 +1,203 @@
+package redistoretest
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrInjected is the default error Chaos fails commands with.
+var ErrInjected = errors.New("redistoretest: injected fault")
+
+// Fault describes the faults Chaos injects into a command. The rates are
+// probabilities between 0 and 1 and are exclusive: at most one failure is
+// injected per command, picked with a single random draw.
+//
+// Fields:
+//
+//	Latency: Delay added before the command is sent. A context that ends
+//	  during the delay fails the command with the context's error.
+//	ErrorRate: Rate of failures with Err.
+//	Err: The error of ErrorRate failures. Defaults to ErrInjected.
+//	TimeoutRate: Rate of failures with a net.Error whose Timeout method
+//	  reports true, as when a read deadline passes.
+//	ResetRate: Rate of failures with a connection reset error, for which
+//	  errors.Is(err, syscall.ECONNRESET) holds.
+type Fault struct {
+	Latency     time.Duration
+	ErrorRate   float64
+	Err         error
+	TimeoutRate float64
+	ResetRate   float64
+}
+
+// Chaos is a go-redis hook that injects faults into commands, to test how
+// code behaves when Redis is slow or failing. Add it to the client of a
+// RediStore:
+//
+//	chaos := redistoretest.NewChaos()
+//	store.Client.AddHook(chaos)
+//	chaos.Set("get", redistoretest.Fault{ErrorRate: 1})
+//
+// Faults are configured per command and can be changed or cleared at any
+// time, so tests can break Redis and then check recovery. It is safe for
+// concurrent use.
+type Chaos struct {
+	mu       sync.Mutex
+	faults   map[string]Fault
+	rand     *rand.Rand
+	injected int
+}
+
+// NewChaos returns a Chaos injecting no faults.
+func NewChaos() *Chaos {
+	return &Chaos{
+		faults: make(map[string]Fault),
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Set sets the faults injected into the command with the given name, e.g.
+// "get" or "evalsha". The name "*" sets the faults of commands that have
+// none of their own.
+func (c *Chaos) Set(command string, f Fault) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.faults[strings.ToLower(command)] = f
+}
+
+// Clear removes all faults.
+func (c *Chaos) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.faults = make(map[string]Fault)
+}
+
+// SetSeed seeds the random draws, making the injected failures repeatable.
+func (c *Chaos) SetSeed(seed int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rand = rand.New(rand.NewSource(seed))
+}
+
+// Injected returns the number of commands and pipelines failures were
+// injected into so far.
+func (c *Chaos) Injected() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.injected
+}
+
+// DialHook implements redis.Hook. Connections are not affected.
+func (c *Chaos) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+// ProcessHook implements redis.Hook.
+func (c *Chaos) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		latency, err := c.draw(cmd)
+		if err := sleep(ctx, latency); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		if err != nil {
+			c.record()
+			cmd.SetErr(err)
+			return err
+		}
+		return next(ctx, cmd)
+	}
+}
+
+// ProcessPipelineHook implements redis.Hook. Pipelines are delayed by the
+// largest latency of their commands, and fail as a whole if a failure is
+// injected into any of them, as when the connection fails.
+func (c *Chaos) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		var latency time.Duration
+		var err error
+		for _, cmd := range cmds {
+			l, e := c.draw(cmd)
+			latency = max(latency, l)
+			if err == nil {
+				err = e
+			}
+		}
+		if err != nil {
+			c.record()
+		}
+		if e := sleep(ctx, latency); e != nil {
+			err = e
+		}
+		if err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		return next(ctx, cmds)
+	}
+}
+
+// draw returns the latency and failure, if any, to inject into cmd.
+func (c *Chaos) draw(cmd redis.Cmder) (time.Duration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, ok := c.faults[strings.ToLower(cmd.Name())]
+	if !ok {
+		if f, ok = c.faults["*"]; !ok {
+			return 0, nil
+		}
+	}
+	var err error
+	switch r := c.rand.Float64(); {
+	case r < f.ErrorRate:
+		err = f.Err
+		if err == nil {
+			err = ErrInjected
+		}
+	case r < f.ErrorRate+f.TimeoutRate:
+		err = &net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}}
+	case r < f.ErrorRate+f.TimeoutRate+f.ResetRate:
+		err = &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	}
+	return f.Latency, err
+}
+
+// record counts an injected failure.
+func (c *Chaos) record() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.injected++
+}
+
+// sleep waits for d or until ctx ends, returning the context's error then.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// timeoutError is an injected i/o timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
@@ -0,0 +1,150 @@
+package redistoretest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/poseidonphp/redistore"
+	"github.com/poseidonphp/redistore/redistoretest/redisserver"
+)
+
+func TestChaos(t *testing.T) {
+	srv, err := redisserver.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := srv.Close(); err != nil {
+			fmt.Printf("Error closing server: %v\n", err)
+		}
+	}()
+	store, err := redistore.NewRediStore([]string{srv.URL()}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	chaos := NewChaos()
+	store.Client.AddHook(chaos)
+
+	session := sessions.NewSession(store, "session-key")
+	session.Options = &sessions.Options{MaxAge: 60}
+	session.Values["user_id"] = 42
+	rsp := httptest.NewRecorder()
+	if err := store.Save(nil, rsp, session); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "http://localhost/", nil)
+	req.AddCookie(rsp.Result().Cookies()[0])
+
+	// Load errors are returned by New along with a new session.
+	chaos.Set("get", Fault{ErrorRate: 1})
+	loaded, err := store.New(req, "session-key")
+	if !errors.Is(err, ErrInjected) || !loaded.IsNew {
+		t.Errorf("Expected ErrInjected and a new session; Got %v, %v", err, loaded.IsNew)
+	}
+
+	// Save errors are returned by Save, for plain commands and pipelines.
+	chaos.Set("setex", Fault{TimeoutRate: 1})
+	var ne net.Error
+	if err := store.Save(nil, httptest.NewRecorder(), session); !errors.As(err, &ne) || !ne.Timeout() {
+		t.Errorf("Expected a timeout; Got %v", err)
+	}
+	chaos.Set("del", Fault{ResetRate: 1})
+	session.Options.MaxAge = -1
+	if err := store.Save(nil, httptest.NewRecorder(), session); !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("Expected a connection reset; Got %v", err)
+	}
+	if n := chaos.Injected(); n != 3 {
+		t.Errorf("Expected 3 injected failures; Got %d", n)
+	}
+
+	// The store recovers once the faults clear.
+	chaos.Clear()
+	loaded, err = store.New(req, "session-key")
+	if err != nil || loaded.IsNew || loaded.Values["user_id"] != 42 {
+		t.Errorf("Expected the saved session; Got %v, %v, %v", loaded.IsNew, loaded.Values, err)
+	}
+}
+
+func TestChaosLatency(t *testing.T) {
+	srv, err := redisserver.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := srv.Close(); err != nil {
+			fmt.Printf("Error closing server: %v\n", err)
+		}
+	}()
+	store, err := redistore.NewRediStore([]string{srv.URL()}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	chaos := NewChaos()
+	store.Client.AddHook(chaos)
+
+	chaos.Set("ping", Fault{Latency: 50 * time.Millisecond})
+	start := time.Now()
+	if err := store.Client.Ping(context.Background()).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("Expected at least 50ms; Got %v", d)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := store.Client.Ping(ctx).Err(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline to pass; Got %v", err)
+	}
+}
+
+func TestChaosRate(t *testing.T) {
+	srv, err := redisserver.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := srv.Close(); err != nil {
+			fmt.Printf("Error closing server: %v\n", err)
+		}
+	}()
+	store, err := redistore.NewRediStore([]string{srv.URL()}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	chaos := NewChaos()
+	chaos.SetSeed(1)
+	store.Client.AddHook(chaos)
+
+	chaos.Set("*", Fault{ErrorRate: 0.5})
+	failed := 0
+	for i := 0; i < 200; i++ {
+		if err := store.Client.Exists(context.Background(), "k").Err(); err != nil {
+			failed++
+		}
+	}
+	if failed < 50 || failed > 150 || failed != chaos.Injected() {
+		t.Errorf("Expected about half to fail; Got %d failed, %d injected", failed, chaos.Injected())
+	}
+}
@@ -0,0 +1,936 @@
+package redisserver
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// command is an entry of the command table.
+//
+// Fields:
+//
+//	arity: The number of arguments including the command name; negative
+//	  for a minimum of -arity.
+//	flags: A combination of flagNoAuth and flagNoScript.
+//	fn: Runs the command with the arguments after its name.
+type command struct {
+	arity int
+	flags int
+	fn    func(c *client, args []string) interface{}
+}
+
+const (
+	flagNoAuth   = 1 << iota // allowed before authenticating
+	flagNoScript             // not allowed inside scripts
+)
+
+var (
+	replyOK      = status("OK")
+	errWrongType = redisError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errSyntax    = redisError("ERR syntax error")
+	errNotInt    = redisError("ERR value is not an integer or out of range")
+	errNotFloat  = redisError("ERR value is not a valid float")
+)
+
+// commands is the command table, keyed by lower case name.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"ping":        {-1, 0, cmdPing},
+		"echo":        {2, 0, cmdEcho},
+		"auth":        {-2, flagNoAuth | flagNoScript, cmdAuth},
+		"hello":       {-1, flagNoAuth | flagNoScript, cmdHello},
+		"select":      {2, flagNoScript, cmdSelect},
+		"client":      {-2, flagNoScript, cmdClient},
+		"quit":        {-1, flagNoAuth | flagNoScript, cmdQuit},
+		"wait":        {3, flagNoScript, cmdWait},
+		"del":         {-2, 0, cmdDel},
+		"unlink":      {-2, 0, cmdDel},
+		"exists":      {-2, 0, cmdExists},
+		"expire":      {-3, 0, cmdExpire(time.Second)},
+		"pexpire":     {-3, 0, cmdExpire(time.Millisecond)},
+		"ttl":         {2, 0, cmdTTL(time.Second)},
+		"pttl":        {2, 0, cmdTTL(time.Millisecond)},
+		"persist":     {2, 0, cmdPersist},
+		"type":        {2, 0, cmdType},
+		"keys":        {2, 0, cmdKeys},
+		"scan":        {-2, 0, cmdScan},
+		"dbsize":      {1, 0, cmdDBSize},
+		"flushdb":     {-1, 0, cmdFlushDB},
+		"flushall":    {-1, 0, cmdFlushAll},
+		"get":         {2, 0, cmdGet},
+		"set":         {-3, 0, cmdSet},
+		"setex":       {4, 0, cmdSetEx(time.Second)},
+		"psetex":      {4, 0, cmdSetEx(time.Millisecond)},
+		"setnx":       {3, 0, cmdSetNX},
+		"getdel":      {2, 0, cmdGetDel},
+		"mget":        {-2, 0, cmdMGet},
+		"incr":        {2, 0, cmdIncr},
+		"incrby":      {3, 0, cmdIncrBy},
+		"hset":        {-4, 0, cmdHSet},
+		"hsetnx":      {4, 0, cmdHSetNX},
+		"hget":        {3, 0, cmdHGet},
+		"hgetall":     {2, 0, cmdHGetAll},
+		"hdel":        {-3, 0, cmdHDel},
+		"hlen":        {2, 0, cmdHLen},
+		"zadd":        {-4, 0, cmdZAdd},
+		"zrem":        {-3, 0, cmdZRem},
+		"zcard":       {2, 0, cmdZCard},
+		"zscore":      {3, 0, cmdZScore},
+		"zrange":      {-4, 0, cmdZRange},
+		"multi":       {1, flagNoScript, cmdMulti},
+		"exec":        {1, flagNoScript, cmdExec},
+		"discard":     {1, flagNoScript, cmdDiscard},
+		"eval":        {-3, flagNoScript, cmdEval},
+		"evalsha":     {-3, flagNoScript, cmdEvalSHA},
+		"script":      {-2, flagNoScript, cmdScript},
+		"subscribe":   {-2, flagNoScript, cmdSubscribe},
+		"unsubscribe": {-1, flagNoScript, cmdUnsubscribe},
+		"publish":     {3, 0, cmdPublish},
+	}
+}
+
+// database returns the selected database.
+func (c *client) database() *database {
+	return c.srv.dbs[c.db]
+}
+
+// now returns the current time of the server clock.
+func (c *client) now() time.Time {
+	return c.srv.now()
+}
+
+// lookup returns the live entry of key.
+func (c *client) lookup(key string) *entry {
+	return c.database().get(c.now(), key)
+}
+
+// ----------------------------------------------------------------------------
+// Connection
+
+func cmdPing(c *client, args []string) interface{} {
+	if c.proto == 2 && len(c.channels) > 0 && len(args) <= 1 {
+		// A subscribed RESP2 connection gets an array, like a message.
+		payload := ""
+		if len(args) == 1 {
+			payload = args[0]
+		}
+		return []interface{}{"pong", payload}
+	}
+	switch len(args) {
+	case 0:
+		return status("PONG")
+	case 1:
+		return args[0]
+	}
+	return redisError("ERR wrong number of arguments for 'ping' command")
+}
+
+func cmdEcho(c *client, args []string) interface{} {
+	return args[0]
+}
+
+func cmdAuth(c *client, args []string) interface{} {
+	if len(args) > 2 {
+		return errSyntax
+	}
+	user, password := "default", args[len(args)-1]
+	if len(args) == 2 {
+		user = args[0]
+	}
+	if c.srv.password == "" && len(args) == 1 {
+		return redisError("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+	}
+	return c.authenticate(user, password)
+}
+
+// authenticate checks the credentials of the default user.
+func (c *client) authenticate(user, password string) interface{} {
+	if user != "default" || (c.srv.password != "" && password != c.srv.password) {
+		return redisError("WRONGPASS invalid username-password pair or user is disabled.")
+	}
+	c.authed = true
+	return replyOK
+}
+
+func cmdHello(c *client, args []string) interface{} {
+	proto := c.proto
+	if len(args) > 0 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil {
+			return redisError("ERR Protocol version is not an integer or out of range")
+		}
+		if v != 2 && v != 3 {
+			return redisError("NOPROTO unsupported protocol version")
+		}
+		proto = v
+		args = args[1:]
+	}
+	for len(args) > 0 {
+		switch {
+		case strings.EqualFold(args[0], "auth") && len(args) >= 3:
+			if err, ok := c.authenticate(args[1], args[2]).(redisError); ok {
+				return err
+			}
+			args = args[3:]
+		case strings.EqualFold(args[0], "setname") && len(args) >= 2:
+			args = args[2:]
+		default:
+			return redisError("ERR Syntax error in HELLO option '" + args[0] + "'")
+		}
+	}
+	if !c.authed {
+		return redisError("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+	}
+	c.proto = proto
+	return mapReply{
+		"server", "redis",
+		"version", "7.2.0",
+		"proto", int64(proto),
+		"id", c.id,
+		"mode", "standalone",
+		"role", "master",
+		"modules", []interface{}{},
+	}
+}
+
+func cmdSelect(c *client, args []string) interface{} {
+	db, err := strconv.Atoi(args[0])
+	if err != nil {
+		return errNotInt
+	}
+	if db < 0 || db >= numDatabases {
+		return redisError("ERR DB index is out of range")
+	}
+	c.db = db
+	return replyOK
+}
+
+func cmdClient(c *client, args []string) interface{} {
+	switch strings.ToLower(args[0]) {
+	case "id":
+		return c.id
+	case "setname", "setinfo", "no-evict", "no-touch":
+		return replyOK
+	case "getname":
+		return nil
+	}
+	return redisError("ERR unknown subcommand '" + args[0] + "'. Try CLIENT HELP.")
+}
+
+func cmdQuit(c *client, args []string) interface{} {
+	c.quit = true
+	return replyOK
+}
+
+func cmdWait(c *client, args []string) interface{} {
+	if _, err := strconv.ParseInt(args[0], 10, 64); err != nil {
+		return errNotInt
+	}
+	timeout, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return errNotInt
+	}
+	if timeout < 0 {
+		return redisError("ERR timeout is negative")
+	}
+	return int64(c.srv.replicas)
+}
+
+// ----------------------------------------------------------------------------
+// Keys
+
+func cmdDel(c *client, args []string) interface{} {
+	var n int64
+	for _, k := range args {
+		if c.database().del(c.now(), k) {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdExists(c *client, args []string) interface{} {
+	var n int64
+	for _, k := range args {
+		if c.lookup(k) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdExpire(unit time.Duration) func(c *client, args []string) interface{} {
+	return func(c *client, args []string) interface{} {
+		v, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return errNotInt
+		}
+		e := c.lookup(args[0])
+		var nx, xx, gt, lt bool
+		for _, opt := range args[2:] {
+			switch strings.ToLower(opt) {
+			case "nx":
+				nx = true
+			case "xx":
+				xx = true
+			case "gt":
+				gt = true
+			case "lt":
+				lt = true
+			default:
+				return redisError("ERR Unsupported option " + opt)
+			}
+		}
+		if nx && (xx || gt || lt) || gt && lt {
+			return redisError("ERR NX and XX, GT or LT options at the same time are not compatible")
+		}
+		if e == nil {
+			return int64(0)
+		}
+		expires := c.now().Add(time.Duration(v) * unit)
+		switch {
+		case nx && !e.expires.IsZero(),
+			xx && e.expires.IsZero(),
+			gt && (e.expires.IsZero() || !expires.After(e.expires)),
+			lt && !e.expires.IsZero() && !expires.Before(e.expires):
+			return int64(0)
+		}
+		if v <= 0 {
+			c.database().del(c.now(), args[0])
+			return int64(1)
+		}
+		e.expires = expires
+		return int64(1)
+	}
+}
+
+func cmdTTL(unit time.Duration) func(c *client, args []string) interface{} {
+	return func(c *client, args []string) interface{} {
+		e := c.lookup(args[0])
+		switch {
+		case e == nil:
+			return int64(-2)
+		case e.expires.IsZero():
+			return int64(-1)
+		}
+		left := e.expires.Sub(c.now())
+		return int64((left + unit/2) / unit)
+	}
+}
+
+func cmdPersist(c *client, args []string) interface{} {
+	e := c.lookup(args[0])
+	if e == nil || e.expires.IsZero() {
+		return int64(0)
+	}
+	e.expires = time.Time{}
+	return int64(1)
+}
+
+func cmdType(c *client, args []string) interface{} {
+	e := c.lookup(args[0])
+	if e == nil {
+		return status("none")
+	}
+	return status(typeName(e.value))
+}
+
+func cmdKeys(c *client, args []string) interface{} {
+	return stringsReply(c.database().keys(c.now(), args[0]))
+}
+
+// cmdScan walks the keys in creation order. The cursor is the creation
+// sequence number to resume from, so keys present for the whole scan are
+// returned exactly once.
+func cmdScan(c *client, args []string) interface{} {
+	cursor, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return redisError("ERR invalid cursor")
+	}
+	pattern, count, typ := "*", 10, ""
+	for opts := args[1:]; len(opts) > 0; opts = opts[2:] {
+		if len(opts) < 2 {
+			return errSyntax
+		}
+		switch strings.ToLower(opts[0]) {
+		case "match":
+			pattern = opts[1]
+		case "count":
+			count, err = strconv.Atoi(opts[1])
+			if err != nil {
+				return errNotInt
+			}
+			if count < 1 {
+				return errSyntax
+			}
+		case "type":
+			typ = strings.ToLower(opts[1])
+		default:
+			return errSyntax
+		}
+	}
+	db, now := c.database(), c.now()
+	var keys []interface{}
+	next := uint64(0)
+	examined := 0
+	for _, k := range db.live(now) {
+		e := db.get(now, k)
+		if e.seq < cursor {
+			continue
+		}
+		if examined == count {
+			next = e.seq
+			break
+		}
+		examined++
+		if globMatch(pattern, k) && (typ == "" || typeName(e.value) == typ) {
+			keys = append(keys, k)
+		}
+	}
+	if keys == nil {
+		keys = []interface{}{}
+	}
+	return []interface{}{strconv.FormatUint(next, 10), keys}
+}
+
+func cmdDBSize(c *client, args []string) interface{} {
+	return int64(len(c.database().live(c.now())))
+}
+
+func cmdFlushDB(c *client, args []string) interface{} {
+	c.srv.dbs[c.db] = newDatabase()
+	return replyOK
+}
+
+func cmdFlushAll(c *client, args []string) interface{} {
+	for i := range c.srv.dbs {
+		c.srv.dbs[i] = newDatabase()
+	}
+	return replyOK
+}
+
+// ----------------------------------------------------------------------------
+// Strings
+
+// getString returns the string stored under key, or an error reply if it
+// holds another type.
+func (c *client) getString(key string) (string, bool, interface{}) {
+	e := c.lookup(key)
+	if e == nil {
+		return "", false, nil
+	}
+	s, ok := e.value.(string)
+	if !ok {
+		return "", false, errWrongType
+	}
+	return s, true, nil
+}
+
+func cmdGet(c *client, args []string) interface{} {
+	s, ok, err := c.getString(args[0])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	return s
+}
+
+func cmdSet(c *client, args []string) interface{} {
+	key, value := args[0], args[1]
+	var (
+		expires           time.Time
+		nx, xx, keep, get bool
+		hasExpiry         bool
+	)
+	now := c.now()
+	for opts := args[2:]; len(opts) > 0; opts = opts[1:] {
+		switch opt := strings.ToLower(opts[0]); opt {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "keepttl":
+			keep = true
+		case "get":
+			get = true
+		case "ex", "px", "exat", "pxat":
+			if len(opts) < 2 || hasExpiry {
+				return errSyntax
+			}
+			v, err := strconv.ParseInt(opts[1], 10, 64)
+			if err != nil {
+				return errNotInt
+			}
+			if v <= 0 {
+				return redisError("ERR invalid expire time in 'set' command")
+			}
+			switch opt {
+			case "ex":
+				expires = now.Add(time.Duration(v) * time.Second)
+			case "px":
+				expires = now.Add(time.Duration(v) * time.Millisecond)
+			case "exat":
+				expires = time.Unix(v, 0)
+			case "pxat":
+				expires = time.UnixMilli(v)
+			}
+			hasExpiry = true
+			opts = opts[1:]
+		default:
+			return errSyntax
+		}
+	}
+	if nx && xx || keep && hasExpiry {
+		return errSyntax
+	}
+	old, exists, err := c.getString(key)
+	if err != nil && get {
+		return err
+	}
+	var reply interface{} = replyOK
+	if get {
+		reply = nil
+		if exists {
+			reply = old
+		}
+	}
+	e := c.lookup(key)
+	if nx && e != nil || xx && e == nil {
+		if get {
+			return reply
+		}
+		return nil
+	}
+	if keep && e != nil {
+		expires = e.expires
+	}
+	c.database().set(now, key, value, expires)
+	return reply
+}
+
+func cmdSetEx(unit time.Duration) func(c *client, args []string) interface{} {
+	return func(c *client, args []string) interface{} {
+		v, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return errNotInt
+		}
+		if v <= 0 {
+			name := "setex"
+			if unit == time.Millisecond {
+				name = "psetex"
+			}
+			return redisError("ERR invalid expire time in '" + name + "' command")
+		}
+		c.database().set(c.now(), args[0], args[2], c.now().Add(time.Duration(v)*unit))
+		return replyOK
+	}
+}
+
+func cmdSetNX(c *client, args []string) interface{} {
+	if c.lookup(args[0]) != nil {
+		return int64(0)
+	}
+	c.database().set(c.now(), args[0], args[1], time.Time{})
+	return int64(1)
+}
+
+func cmdGetDel(c *client, args []string) interface{} {
+	reply := cmdGet(c, args)
+	if s, ok := reply.(string); ok {
+		c.database().del(c.now(), args[0])
+		return s
+	}
+	return reply
+}
+
+func cmdMGet(c *client, args []string) interface{} {
+	out := make([]interface{}, len(args))
+	for i, k := range args {
+		if s, ok, err := c.getString(k); err == nil && ok {
+			out[i] = s
+		}
+	}
+	return out
+}
+
+func cmdIncr(c *client, args []string) interface{} {
+	return c.incrBy(args[0], 1)
+}
+
+func cmdIncrBy(c *client, args []string) interface{} {
+	by, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return errNotInt
+	}
+	return c.incrBy(args[0], by)
+}
+
+func (c *client) incrBy(key string, by int64) interface{} {
+	s, ok, errReply := c.getString(key)
+	if errReply != nil {
+		return errReply
+	}
+	var n int64
+	if ok {
+		var err error
+		if n, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return errNotInt
+		}
+	}
+	if by > 0 && n > math.MaxInt64-by || by < 0 && n < math.MinInt64-by {
+		return redisError("ERR increment or decrement would overflow")
+	}
+	n += by
+	var expires time.Time
+	if e := c.lookup(key); e != nil {
+		expires = e.expires
+	}
+	c.database().set(c.now(), key, strconv.FormatInt(n, 10), expires)
+	return n
+}
+
+// ----------------------------------------------------------------------------
+// Hashes
+
+// getHash returns the hash stored under key, creating it if create is set.
+// It returns an error reply if the key holds another type.
+func (c *client) getHash(key string, create bool) (map[string]string, interface{}) {
+	e := c.lookup(key)
+	if e == nil {
+		if !create {
+			return nil, nil
+		}
+		h := make(map[string]string)
+		c.database().set(c.now(), key, h, time.Time{})
+		return h, nil
+	}
+	h, ok := e.value.(map[string]string)
+	if !ok {
+		return nil, errWrongType
+	}
+	return h, nil
+}
+
+func cmdHSet(c *client, args []string) interface{} {
+	if len(args)%2 != 1 {
+		return redisError("ERR wrong number of arguments for 'hset' command")
+	}
+	h, err := c.getHash(args[0], true)
+	if err != nil {
+		return err
+	}
+	var n int64
+	for i := 1; i < len(args); i += 2 {
+		if _, ok := h[args[i]]; !ok {
+			n++
+		}
+		h[args[i]] = args[i+1]
+	}
+	return n
+}
+
+func cmdHSetNX(c *client, args []string) interface{} {
+	h, err := c.getHash(args[0], true)
+	if err != nil {
+		return err
+	}
+	if _, ok := h[args[1]]; ok {
+		return int64(0)
+	}
+	h[args[1]] = args[2]
+	return int64(1)
+}
+
+func cmdHGet(c *client, args []string) interface{} {
+	h, err := c.getHash(args[0], false)
+	if err != nil {
+		return err
+	}
+	v, ok := h[args[1]]
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+func cmdHGetAll(c *client, args []string) interface{} {
+	h, err := c.getHash(args[0], false)
+	if err != nil {
+		return err
+	}
+	out := make(mapReply, 0, 2*len(h))
+	for k, v := range h {
+		out = append(out, k, v)
+	}
+	return out
+}
+
+func cmdHDel(c *client, args []string) interface{} {
+	h, err := c.getHash(args[0], false)
+	if err != nil {
+		return err
+	}
+	var n int64
+	for _, f := range args[1:] {
+		if _, ok := h[f]; ok {
+			delete(h, f)
+			n++
+		}
+	}
+	if h != nil && len(h) == 0 {
+		c.database().del(c.now(), args[0])
+	}
+	return n
+}
+
+func cmdHLen(c *client, args []string) interface{} {
+	h, err := c.getHash(args[0], false)
+	if err != nil {
+		return err
+	}
+	return int64(len(h))
+}
+
+// ----------------------------------------------------------------------------
+// Sorted sets
+
+// getZSet returns the sorted set stored under key, or an error reply if the
+// key holds another type.
+func (c *client) getZSet(key string) (*zset, interface{}) {
+	e := c.lookup(key)
+	if e == nil {
+		return nil, nil
+	}
+	z, ok := e.value.(*zset)
+	if !ok {
+		return nil, errWrongType
+	}
+	return z, nil
+}
+
+func cmdZAdd(c *client, args []string) interface{} {
+	key := args[0]
+	var nx, xx, gt, lt, ch bool
+	args = args[1:]
+flags:
+	for len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "gt":
+			gt = true
+		case "lt":
+			lt = true
+		case "ch":
+			ch = true
+		default:
+			break flags
+		}
+		args = args[1:]
+	}
+	if len(args) == 0 || len(args)%2 != 0 {
+		return errSyntax
+	}
+	if nx && xx {
+		return redisError("ERR XX and NX options at the same time are not compatible")
+	}
+	if gt && lt || nx && (gt || lt) {
+		return redisError("ERR GT, LT, and/or NX options at the same time are not compatible")
+	}
+	scores := make([]float64, len(args)/2)
+	for i := range scores {
+		f, ok := parseFloat(args[2*i])
+		if !ok {
+			return errNotFloat
+		}
+		scores[i] = f
+	}
+	z, err := c.getZSet(key)
+	if err != nil {
+		return err
+	}
+	if z == nil {
+		if xx {
+			return int64(0)
+		}
+		z = &zset{scores: make(map[string]float64)}
+		c.database().set(c.now(), key, z, time.Time{})
+	}
+	var added, changed int64
+	for i, score := range scores {
+		member := args[2*i+1]
+		old, exists := z.scores[member]
+		switch {
+		case exists && nx, !exists && xx:
+			continue
+		case exists && (gt && score <= old || lt && score >= old):
+			continue
+		}
+		if !exists {
+			added++
+		} else if old != score {
+			changed++
+		}
+		z.scores[member] = score
+	}
+	if len(z.scores) == 0 {
+		c.database().del(c.now(), key)
+	}
+	if ch {
+		return added + changed
+	}
+	return added
+}
+
+func cmdZRem(c *client, args []string) interface{} {
+	z, err := c.getZSet(args[0])
+	if err != nil || z == nil {
+		if err != nil {
+			return err
+		}
+		return int64(0)
+	}
+	var n int64
+	for _, m := range args[1:] {
+		if _, ok := z.scores[m]; ok {
+			delete(z.scores, m)
+			n++
+		}
+	}
+	if len(z.scores) == 0 {
+		c.database().del(c.now(), args[0])
+	}
+	return n
+}
+
+func cmdZCard(c *client, args []string) interface{} {
+	z, err := c.getZSet(args[0])
+	if err != nil {
+		return err
+	}
+	if z == nil {
+		return int64(0)
+	}
+	return int64(len(z.scores))
+}
+
+func cmdZScore(c *client, args []string) interface{} {
+	z, err := c.getZSet(args[0])
+	if err != nil {
+		return err
+	}
+	if z == nil {
+		return nil
+	}
+	score, ok := z.scores[args[1]]
+	if !ok {
+		return nil
+	}
+	return score
+}
+
+// cmdZRange supports ranges by index only, with REV and WITHSCORES.
+func cmdZRange(c *client, args []string) interface{} {
+	start, err1 := strconv.Atoi(args[1])
+	stop, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return errNotInt
+	}
+	var rev, withScores bool
+	for _, opt := range args[3:] {
+		switch strings.ToLower(opt) {
+		case "rev":
+			rev = true
+		case "withscores":
+			withScores = true
+		default:
+			return errSyntax
+		}
+	}
+	z, err := c.getZSet(args[0])
+	if err != nil {
+		return err
+	}
+	out := []interface{}{}
+	if z == nil {
+		return out
+	}
+	members := z.sorted()
+	if rev {
+		for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+			members[i], members[j] = members[j], members[i]
+		}
+	}
+	n := len(members)
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if stop < 0 {
+		stop = n + stop
+	}
+	stop = min(stop, n-1)
+	for i := start; i <= stop; i++ {
+		m := members[i]
+		switch {
+		case !withScores:
+			out = append(out, m.member)
+		case c.proto == 3:
+			out = append(out, []interface{}{m.member, m.score})
+		default:
+			out = append(out, m.member, m.score)
+		}
+	}
+	return out
+}
+
+// ----------------------------------------------------------------------------
+// Transactions
+
+func cmdMulti(c *client, args []string) interface{} {
+	if c.multi {
+		return redisError("ERR MULTI calls can not be nested")
+	}
+	c.multi, c.dirty, c.queue = true, false, nil
+	return replyOK
+}
+
+func cmdExec(c *client, args []string) interface{} {
+	if !c.multi {
+		return redisError("ERR EXEC without MULTI")
+	}
+	queue, dirty := c.queue, c.dirty
+	c.multi, c.dirty, c.queue = false, false, nil
+	if dirty {
+		return redisError("EXECABORT Transaction discarded because of previous errors.")
+	}
+	out := make([]interface{}, len(queue))
+	for i, args := range queue {
+		out[i] = c.call(args)
+	}
+	return out
+}
+
+func cmdDiscard(c *client, args []string) interface{} {
+	if !c.multi {
+		return redisError("ERR DISCARD without MULTI")
+	}
+	c.multi, c.dirty, c.queue = false, false, nil
+	return replyOK
+}
+
+// stringsReply converts a list of strings to an array reply.
+func stringsReply(ss []string) []interface{} {
+	out := make([]interface{}, len(ss))
+	for i, s := range ss {
+		out[i] = s
+	}
+	return out
+}
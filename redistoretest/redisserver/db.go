@@ -0,0 +1,206 @@
+package redisserver
+
+import (
+	"sort"
+	"time"
+)
+
+// database is one of the numbered databases of a Server.
+type database struct {
+	entries map[string]*entry
+	nextSeq uint64
+}
+
+// entry is a key with its value and expiry.
+//
+// Fields:
+//
+//	value: A string, hash (map[string]string) or sorted set (*zset).
+//	expires: When the key expires. Zero means never.
+//	seq: Creation order, which SCAN cursors walk.
+type entry struct {
+	value   interface{}
+	expires time.Time
+	seq     uint64
+}
+
+func newDatabase() *database {
+	return &database{entries: make(map[string]*entry)}
+}
+
+// get returns the live entry of key, deleting it if it has expired.
+func (db *database) get(now time.Time, key string) *entry {
+	e, ok := db.entries[key]
+	if !ok {
+		return nil
+	}
+	if !e.expires.IsZero() && !now.Before(e.expires) {
+		delete(db.entries, key)
+		return nil
+	}
+	return e
+}
+
+// set stores value under key with the given expiry, keeping the creation
+// order of an existing key.
+func (db *database) set(now time.Time, key string, value interface{}, expires time.Time) {
+	if e := db.get(now, key); e != nil {
+		e.value, e.expires = value, expires
+		return
+	}
+	db.nextSeq++
+	db.entries[key] = &entry{value: value, expires: expires, seq: db.nextSeq}
+}
+
+// del removes key, reporting whether it was live.
+func (db *database) del(now time.Time, key string) bool {
+	e := db.get(now, key)
+	delete(db.entries, key)
+	return e != nil
+}
+
+// live returns the live entries in creation order.
+func (db *database) live(now time.Time) []string {
+	type seqKey struct {
+		seq uint64
+		key string
+	}
+	var all []seqKey
+	for k := range db.entries {
+		if e := db.get(now, k); e != nil {
+			all = append(all, seqKey{e.seq, k})
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].seq < all[j].seq })
+	keys := make([]string, len(all))
+	for i, sk := range all {
+		keys[i] = sk.key
+	}
+	return keys
+}
+
+// keys returns the live keys matching pattern in sorted order.
+func (db *database) keys(now time.Time, pattern string) []string {
+	var keys []string
+	for _, k := range db.live(now) {
+		if globMatch(pattern, k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// typeName returns the name TYPE reports for the value.
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case map[string]string:
+		return "hash"
+	case *zset:
+		return "zset"
+	}
+	return "none"
+}
+
+// zset is a sorted set.
+type zset struct {
+	scores map[string]float64
+}
+
+// zmember is a sorted set member with its score.
+type zmember struct {
+	member string
+	score  float64
+}
+
+// sorted returns the members ordered by score, then member.
+func (z *zset) sorted() []zmember {
+	out := make([]zmember, 0, len(z.scores))
+	for m, s := range z.scores {
+		out = append(out, zmember{m, s})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].score != out[j].score {
+			return out[i].score < out[j].score
+		}
+		return out[i].member < out[j].member
+	})
+	return out
+}
+
+// globMatch reports whether s matches the glob-style pattern as in KEYS,
+// supporting *, ?, [abc], [^abc], [a-z] and backslash escapes.
+func globMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if globMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			p := pattern[1:]
+			negate := len(p) > 0 && p[0] == '^'
+			if negate {
+				p = p[1:]
+			}
+			matched := false
+			for len(p) > 0 && p[0] != ']' {
+				switch {
+				case p[0] == '\\' && len(p) > 1:
+					matched = matched || p[1] == s[0]
+					p = p[2:]
+				case len(p) > 2 && p[1] == '-' && p[2] != ']':
+					lo, hi := p[0], p[2]
+					if lo > hi {
+						lo, hi = hi, lo
+					}
+					matched = matched || (s[0] >= lo && s[0] <= hi)
+					p = p[3:]
+				default:
+					matched = matched || p[0] == s[0]
+					p = p[1:]
+				}
+			}
+			if len(p) > 0 {
+				p = p[1:] // the closing ]
+			}
+			if matched == negate {
+				return false
+			}
+			s = s[1:]
+			pattern = p
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		}
+	}
+	return len(s) == 0
+}
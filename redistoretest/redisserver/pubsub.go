@@ -0,0 +1,112 @@
+package redisserver
+
+import "sort"
+
+// subscribedCommands are the commands a RESP2 connection may run once it
+// has subscribed to a channel.
+var subscribedCommands = map[string]bool{
+	"subscribe": true, "unsubscribe": true, "ping": true, "quit": true,
+}
+
+// checkSubscribed returns an error reply if a RESP2 connection subscribed to
+// a channel may not run the command. RESP3 connections may run any command.
+func (c *client) checkSubscribed(name string) interface{} {
+	if c.proto != 2 || len(c.channels) == 0 || subscribedCommands[name] {
+		return nil
+	}
+	return redisError("ERR Can't execute '" + name + "': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context")
+}
+
+func cmdSubscribe(c *client, args []string) interface{} {
+	replies := make(multiReply, 0, len(args))
+	for _, channel := range args {
+		if _, ok := c.channels[channel]; !ok {
+			if c.channels == nil {
+				c.channels = make(map[string]struct{})
+			}
+			c.channels[channel] = struct{}{}
+			subs := c.srv.channels[channel]
+			if subs == nil {
+				subs = make(map[*client]struct{})
+				c.srv.channels[channel] = subs
+			}
+			subs[c] = struct{}{}
+		}
+		replies = append(replies, pushReply{"subscribe", channel, int64(len(c.channels))})
+	}
+	return replies
+}
+
+func cmdUnsubscribe(c *client, args []string) interface{} {
+	if len(args) == 0 {
+		if len(c.channels) == 0 {
+			return pushReply{"unsubscribe", nil, int64(0)}
+		}
+		for channel := range c.channels {
+			args = append(args, channel)
+		}
+		sort.Strings(args)
+	}
+	replies := make(multiReply, 0, len(args))
+	for _, channel := range args {
+		c.unsubscribe(channel)
+		replies = append(replies, pushReply{"unsubscribe", channel, int64(len(c.channels))})
+	}
+	return replies
+}
+
+// unsubscribe removes c from the subscribers of channel.
+func (c *client) unsubscribe(channel string) {
+	delete(c.channels, channel)
+	if subs := c.srv.channels[channel]; subs != nil {
+		delete(subs, c)
+		if len(subs) == 0 {
+			delete(c.srv.channels, channel)
+		}
+	}
+}
+
+func cmdPublish(c *client, args []string) interface{} {
+	subs := c.srv.channels[args[0]]
+	for sub := range subs {
+		sub.push(pushReply{"message", args[0], args[1]})
+	}
+	return int64(len(subs))
+}
+
+// push queues a message for delivery to the connection of c. The server lock
+// is held.
+func (c *client) push(msg interface{}) {
+	c.pending = append(c.pending, msg)
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver writes the messages pushed to c until done is closed. Replies and
+// messages are written with c.wmu held, so they do not interleave, and a
+// message published after a SUBSCRIBE is written after its reply.
+func (s *Server) deliver(c *client, done <-chan struct{}) {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-done:
+			return
+		case <-c.wake:
+		}
+		c.wmu.Lock()
+		s.mu.Lock()
+		msgs, proto := c.pending, c.proto
+		c.pending = nil
+		s.mu.Unlock()
+		for _, msg := range msgs {
+			writeReply(c.w, msg, proto)
+		}
+		err := c.w.Flush()
+		c.wmu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package redisserver
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestPubSub(t *testing.T) {
+	for _, proto := range []int{2, 3} {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, client := start(t, proto)
+		ps := client.Subscribe(ctx, "a", "b")
+		defer func() {
+			if err := ps.Close(); err != nil {
+				fmt.Printf("Error closing subscription: %v\n", err)
+			}
+		}()
+		for i, channel := range []string{"a", "b"} {
+			msg, err := ps.Receive(ctx)
+			if sub, ok := msg.(*redis.Subscription); err != nil || !ok || sub.Channel != channel || sub.Count != i+1 {
+				t.Fatalf("RESP%d: Expected a subscription to %s; Got %#v, %v", proto, channel, msg, err)
+			}
+		}
+
+		if n, err := client.Publish(ctx, "a", "hello").Result(); err != nil || n != 1 {
+			t.Errorf("RESP%d: Expected 1 receiver; Got %d, %v", proto, n, err)
+		}
+		if n, err := client.Publish(ctx, "c", "nobody").Result(); err != nil || n != 0 {
+			t.Errorf("RESP%d: Expected no receivers; Got %d, %v", proto, n, err)
+		}
+		client.Eval(ctx, "return redis.call('PUBLISH', KEYS[1], ARGV[1])", []string{"b"}, "scripted")
+		for _, want := range []redis.Message{{Channel: "a", Payload: "hello"}, {Channel: "b", Payload: "scripted"}} {
+			msg, err := ps.ReceiveMessage(ctx)
+			if err != nil || msg.Channel != want.Channel || msg.Payload != want.Payload {
+				t.Errorf("RESP%d: Expected %v; Got %v, %v", proto, want, msg, err)
+			}
+		}
+
+		if err := ps.Ping(ctx); err != nil {
+			t.Errorf("RESP%d: %v", proto, err)
+		}
+		if msg, err := ps.Receive(ctx); err != nil {
+			t.Errorf("RESP%d: Expected a pong; Got %v", proto, err)
+		} else if _, ok := msg.(*redis.Pong); !ok && proto == 2 {
+			t.Errorf("RESP%d: Expected a pong; Got %#v", proto, msg)
+		}
+
+		if err := ps.Unsubscribe(ctx); err != nil {
+			t.Fatalf("RESP%d: %v", proto, err)
+		}
+		for i, channel := range []string{"a", "b"} {
+			msg, err := ps.Receive(ctx)
+			if sub, ok := msg.(*redis.Subscription); err != nil || !ok || sub.Kind != "unsubscribe" ||
+				sub.Channel != channel || sub.Count != 1-i {
+				t.Errorf("RESP%d: Expected an unsubscription from %s; Got %#v, %v", proto, channel, msg, err)
+			}
+		}
+		if n, err := client.Publish(ctx, "a", "gone").Result(); err != nil || n != 0 {
+			t.Errorf("RESP%d: Expected no receivers; Got %d, %v", proto, n, err)
+		}
+	}
+}
+
+func TestPubSubRESP2(t *testing.T) {
+	// A subscribed RESP2 connection may only run pub/sub commands.
+	srv, _ := start(t, 2)
+	conn, err := net.Dial("tcp", srv.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			fmt.Printf("Error closing connection: %v\n", err)
+		}
+	}()
+	r := bufio.NewReader(conn)
+	for _, tc := range []struct {
+		send string
+		want []string
+	}{
+		{"SUBSCRIBE a\r\n", []string{"*3", "$9", "subscribe", "$1", "a", ":1"}},
+		{"GET k\r\n", []string{"-ERR Can't execute 'get'"}},
+		{"PING\r\n", []string{"*2", "$4", "pong", "$0", ""}},
+		{"UNSUBSCRIBE\r\n", []string{"*3", "$11", "unsubscribe", "$1", "a", ":0"}},
+		{"GET k\r\n", []string{"$-1"}},
+		{"MULTI\r\n", []string{"+OK"}},
+		{"SUBSCRIBE a\r\n", []string{"-ERR Command not allowed inside a transaction"}},
+	} {
+		conn.Write([]byte(tc.send))
+		for _, want := range tc.want {
+			line, _ := r.ReadString('\n')
+			if !strings.HasPrefix(line, want) {
+				t.Errorf("%q: Expected %q; Got %q", tc.send, want, line)
+			}
+		}
+	}
+}
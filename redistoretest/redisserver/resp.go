@@ -0,0 +1,176 @@
+package redisserver
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Replies are built from these types and encoded by writeReply:
+//
+//	nil: The null reply.
+//	status: A simple string, e.g. OK.
+//	redisError: An error; the message starts with its code, e.g. "ERR".
+//	int64: An integer.
+//	string: A bulk string.
+//	float64: A double, sent as a bulk string over RESP2.
+//	[]interface{}: An array.
+//	mapReply: A map of alternating keys and values, sent as an array over RESP2.
+//	pushReply: Out of band data such as a pub/sub message, sent as an array
+//	  over RESP2.
+//	multiReply: Several replies in a row, as SUBSCRIBE sends one per channel.
+type (
+	status     string
+	redisError string
+	mapReply   []interface{}
+	pushReply  []interface{}
+	multiReply []interface{}
+)
+
+// errProtocol is returned by readCommand for malformed requests.
+var errProtocol = errors.New("Protocol error")
+
+// maxBulkLen limits the size of request arguments, as proto-max-bulk-len.
+const maxBulkLen = 512 << 20
+
+// readCommand reads one request, either a RESP array of bulk strings or an
+// inline command. It returns an empty slice for empty inline commands.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > 1024*1024 {
+		return nil, errProtocol
+	}
+	args := make([]string, 0, max(n, 0))
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, errProtocol
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxBulkLen {
+			return nil, errProtocol
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		if buf[size] != '\r' || buf[size+1] != '\n' {
+			return nil, errProtocol
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+// readLine reads a line terminated by CRLF, or LF for inline commands.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && line != "" {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return strings.TrimSuffix(line[:len(line)-1], "\r"), nil
+}
+
+// writeReply encodes v in the given protocol version.
+func writeReply(w *bufio.Writer, v interface{}, proto int) {
+	switch v := v.(type) {
+	case nil:
+		if proto == 3 {
+			w.WriteString("_\r\n")
+		} else {
+			w.WriteString("$-1\r\n")
+		}
+	case status:
+		w.WriteString("+" + oneLine(string(v)) + "\r\n")
+	case redisError:
+		w.WriteString("-" + oneLine(string(v)) + "\r\n")
+	case int64:
+		w.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+	case int:
+		w.WriteString(":" + strconv.Itoa(v) + "\r\n")
+	case string:
+		w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n")
+	case float64:
+		if proto == 3 {
+			w.WriteString("," + formatFloat(v) + "\r\n")
+		} else {
+			writeReply(w, formatFloat(v), proto)
+		}
+	case []interface{}:
+		w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, e := range v {
+			writeReply(w, e, proto)
+		}
+	case mapReply:
+		if proto == 3 {
+			w.WriteString("%" + strconv.Itoa(len(v)/2) + "\r\n")
+		} else {
+			w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		}
+		for _, e := range v {
+			writeReply(w, e, proto)
+		}
+	case pushReply:
+		if proto == 3 {
+			w.WriteString(">" + strconv.Itoa(len(v)) + "\r\n")
+		} else {
+			w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		}
+		for _, e := range v {
+			writeReply(w, e, proto)
+		}
+	case multiReply:
+		for _, e := range v {
+			writeReply(w, e, proto)
+		}
+	default:
+		panic("redisserver: unsupported reply type")
+	}
+}
+
+// oneLine replaces line breaks, which simple strings and errors cannot
+// contain, with spaces.
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// formatFloat formats f as Redis does, without an exponent for integers.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case f == math.Trunc(f) && math.Abs(f) < 1e17:
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// parseFloat parses a score or increment as Redis does.
+func parseFloat(s string) (float64, bool) {
+	switch strings.ToLower(s) {
+	case "inf", "+inf":
+		return math.Inf(1), true
+	case "-inf":
+		return math.Inf(-1), true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil && !math.IsNaN(f)
+}
@@ -0,0 +1,269 @@
+package redisserver
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"math"
+	"strconv"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+func cmdEval(c *client, args []string) interface{} {
+	proto, err := c.srv.compile(args[0])
+	if err != nil {
+		return err
+	}
+	return c.runScript(proto, args[1:])
+}
+
+func cmdEvalSHA(c *client, args []string) interface{} {
+	proto, ok := c.srv.scripts[strings.ToLower(args[0])]
+	if !ok {
+		return redisError("NOSCRIPT No matching script. Please use EVAL.")
+	}
+	return c.runScript(proto, args[1:])
+}
+
+func cmdScript(c *client, args []string) interface{} {
+	switch strings.ToLower(args[0]) {
+	case "load":
+		if len(args) != 2 {
+			return redisError("ERR wrong number of arguments for 'script|load' command")
+		}
+		if _, err := c.srv.compile(args[1]); err != nil {
+			return err
+		}
+		return scriptSHA(args[1])
+	case "exists":
+		out := make([]interface{}, len(args)-1)
+		for i, sha := range args[1:] {
+			_, ok := c.srv.scripts[strings.ToLower(sha)]
+			out[i] = int64(0)
+			if ok {
+				out[i] = int64(1)
+			}
+		}
+		return out
+	case "flush":
+		c.srv.scripts = make(map[string]*lua.FunctionProto)
+		return replyOK
+	}
+	return redisError("ERR unknown subcommand '" + args[0] + "'. Try SCRIPT HELP.")
+}
+
+// scriptSHA returns the SHA1 digest EVALSHA identifies a script by.
+func scriptSHA(src string) string {
+	sum := sha1.Sum([]byte(src))
+	return hex.EncodeToString(sum[:])
+}
+
+// compile compiles a script and caches it for EVALSHA.
+func (s *Server) compile(src string) (*lua.FunctionProto, interface{}) {
+	sha := scriptSHA(src)
+	if proto, ok := s.scripts[sha]; ok {
+		return proto, nil
+	}
+	chunk, err := parse.Parse(strings.NewReader(src), "user_script")
+	if err != nil {
+		return nil, redisError("ERR Error compiling script (new function): " + err.Error())
+	}
+	proto, err := lua.Compile(chunk, "user_script")
+	if err != nil {
+		return nil, redisError("ERR Error compiling script (new function): " + err.Error())
+	}
+	s.scripts[sha] = proto
+	return proto, nil
+}
+
+// scriptError carries an error reply raised by redis.call out of a script.
+type scriptError struct {
+	reply redisError
+}
+
+func (e *scriptError) Error() string {
+	return string(e.reply)
+}
+
+// runScript runs a compiled script with "numkeys key... arg..." arguments.
+func (c *client) runScript(proto *lua.FunctionProto, args []string) interface{} {
+	numKeys, err := strconv.Atoi(args[0])
+	if err != nil {
+		return errNotInt
+	}
+	if numKeys < 0 {
+		return redisError("ERR Number of keys can't be negative")
+	}
+	if numKeys > len(args)-1 {
+		return redisError("ERR Number of keys can't be greater than number of args")
+	}
+	keys, argv := args[1:1+numKeys], args[1+numKeys:]
+
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	defer L.Close()
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	L.SetGlobal("KEYS", stringTable(L, keys))
+	L.SetGlobal("ARGV", stringTable(L, argv))
+
+	// Commands inside the script run as the calling client, over RESP2.
+	sc := &client{srv: c.srv, id: c.id, db: c.db, proto: 2, authed: true, script: true}
+	redisLib := L.NewTable()
+	redisLib.RawSetString("call", L.NewFunction(func(L *lua.LState) int {
+		return sc.luaCall(L, true)
+	}))
+	redisLib.RawSetString("pcall", L.NewFunction(func(L *lua.LState) int {
+		return sc.luaCall(L, false)
+	}))
+	redisLib.RawSetString("status_reply", L.NewFunction(func(L *lua.LState) int {
+		t := L.NewTable()
+		t.RawSetString("ok", lua.LString(L.CheckString(1)))
+		L.Push(t)
+		return 1
+	}))
+	redisLib.RawSetString("error_reply", L.NewFunction(func(L *lua.LState) int {
+		t := L.NewTable()
+		t.RawSetString("err", lua.LString(L.CheckString(1)))
+		L.Push(t)
+		return 1
+	}))
+	L.SetGlobal("redis", redisLib)
+
+	L.Push(L.NewFunctionFromProto(proto))
+	if err := L.PCall(0, 1, nil); err != nil {
+		if apiErr, ok := err.(*lua.ApiError); ok {
+			if se, ok := apiErr.Object.(*lua.LUserData); ok {
+				if e, ok := se.Value.(*scriptError); ok {
+					return e.reply
+				}
+			}
+		}
+		return redisError("ERR Error running script: " + err.Error())
+	}
+	return fromLua(L.Get(-1))
+}
+
+// luaCall implements redis.call and redis.pcall. Errors are raised by
+// redis.call and returned as {err = ...} tables by redis.pcall.
+func (c *client) luaCall(L *lua.LState, raise bool) int {
+	n := L.GetTop()
+	if n == 0 {
+		L.RaiseError("Please specify at least one argument for this redis lib call")
+	}
+	args := make([]string, n)
+	for i := 1; i <= n; i++ {
+		switch v := L.Get(i).(type) {
+		case lua.LString:
+			args[i-1] = string(v)
+		case lua.LNumber:
+			args[i-1] = formatLuaNumber(float64(v))
+		default:
+			L.RaiseError("Lua redis lib command arguments must be strings or integers")
+		}
+	}
+	reply := c.call(args)
+	if e, ok := reply.(redisError); ok && raise {
+		ud := L.NewUserData()
+		ud.Value = &scriptError{reply: e}
+		L.Error(ud, 1)
+	}
+	L.Push(toLua(L, reply))
+	return 1
+}
+
+// toLua converts a RESP2 reply to a Lua value as Redis does.
+func toLua(L *lua.LState, v interface{}) lua.LValue {
+	switch v := v.(type) {
+	case nil:
+		return lua.LFalse
+	case status:
+		t := L.NewTable()
+		t.RawSetString("ok", lua.LString(v))
+		return t
+	case redisError:
+		t := L.NewTable()
+		t.RawSetString("err", lua.LString(v))
+		return t
+	case int64:
+		return lua.LNumber(v)
+	case int:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case float64:
+		return lua.LString(formatFloat(v))
+	case []interface{}:
+		t := L.CreateTable(len(v), 0)
+		for _, e := range v {
+			t.Append(toLua(L, e))
+		}
+		return t
+	case mapReply:
+		return toLua(L, []interface{}(v))
+	}
+	return lua.LNil
+}
+
+// fromLua converts a script result to a reply as Redis does: numbers are
+// truncated to integers, true is 1, false and nil are null, and arrays end
+// at their first nil.
+func fromLua(v lua.LValue) interface{} {
+	switch v := v.(type) {
+	case lua.LNumber:
+		return int64(v)
+	case lua.LString:
+		return string(v)
+	case lua.LBool:
+		if v {
+			return int64(1)
+		}
+		return nil
+	case *lua.LTable:
+		if e, ok := v.RawGetString("err").(lua.LString); ok {
+			return redisError(e)
+		}
+		if s, ok := v.RawGetString("ok").(lua.LString); ok {
+			return status(s)
+		}
+		out := []interface{}{}
+		for i := 1; ; i++ {
+			e := v.RawGetInt(i)
+			if e == lua.LNil {
+				break
+			}
+			out = append(out, fromLua(e))
+		}
+		return out
+	}
+	return nil
+}
+
+// formatLuaNumber formats a number passed to redis.call as Lua does.
+func formatLuaNumber(f float64) string {
+	if f == math.Trunc(f) && math.Abs(f) < 1e15 {
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return strconv.FormatFloat(f, 'g', 14, 64)
+}
+
+// stringTable returns a Lua array of ss.
+func stringTable(L *lua.LState, ss []string) *lua.LTable {
+	t := L.CreateTable(len(ss), 0)
+	for _, s := range ss {
+		t.Append(lua.LString(s))
+	}
+	return t
+}
@@ -0,0 +1,102 @@
+package redisserver
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestEval(t *testing.T) {
+	ctx := context.Background()
+	_, client := start(t, 3)
+
+	// Run uses EVALSHA and falls back to EVAL.
+	script := redis.NewScript(`
+local live = {}
+for _, id in ipairs(redis.call('ZRANGE', KEYS[1], 0, -1)) do
+  if redis.call('EXISTS', ARGV[1] .. id) == 1 then
+    table.insert(live, id)
+  else
+    redis.call('ZREM', KEYS[1], id)
+  end
+end
+return live
+`)
+	client.ZAdd(ctx, "idx", redis.Z{Score: 1, Member: "a"}, redis.Z{Score: 2, Member: "b"})
+	client.Set(ctx, "s_b", "1", 0)
+	for i := 0; i < 2; i++ {
+		v, err := script.Run(ctx, client, []string{"idx"}, "s_").StringSlice()
+		if err != nil || strings.Join(v, ",") != "b" {
+			t.Errorf("Expected [b]; Got %v, %v", v, err)
+		}
+	}
+	if v := client.ZCard(ctx, "idx").Val(); v != 1 {
+		t.Errorf("Expected the stale member to be removed; Got %d", v)
+	}
+
+	for _, tc := range []struct {
+		src  string
+		want interface{}
+	}{
+		{`return 3.7`, int64(3)},
+		{`return {1, 'a', nil, 2}`, []interface{}{int64(1), "a"}},
+		{`return true`, int64(1)},
+		{`return redis.status_reply('FINE')`, "FINE"},
+		{`return redis.call('SET', KEYS[1], 42, 'EX', 60)`, "OK"},
+		{`return redis.call('GET', KEYS[1])`, "42"},
+		{`return tonumber(redis.call('TTL', KEYS[1]))`, int64(60)},
+		{`if not redis.call('GET', 'missing') then return 'nil is false' end`, "nil is false"},
+		{`return redis.pcall('HGET', KEYS[1], 'f')['err']`, "WRONGTYPE Operation against a key holding the wrong kind of value"},
+	} {
+		v, err := client.Eval(ctx, tc.src, []string{"k"}).Result()
+		if err != nil || !equal(v, tc.want) {
+			t.Errorf("%s: Expected %v; Got %v, %v", tc.src, tc.want, v, err)
+		}
+	}
+
+	for _, tc := range []struct{ src, want string }{
+		{`return redis.call('HGET', KEYS[1], 'f')`, "WRONGTYPE"},
+		{`return redis.error_reply('MY error')`, "MY error"},
+		{`return redis.call('MULTI')`, "ERR This Redis command is not allowed from script"},
+		{`return nosuch()`, "ERR Error running script"},
+		{`return (`, "ERR Error compiling script"},
+	} {
+		err := client.Eval(ctx, tc.src, []string{"k"}).Err()
+		if err == nil || !strings.HasPrefix(err.Error(), tc.want) {
+			t.Errorf("%s: Expected %q; Got %v", tc.src, tc.want, err)
+		}
+	}
+
+	if err := client.EvalSha(ctx, "0000000000000000000000000000000000000000", nil).Err(); err == nil || !strings.HasPrefix(err.Error(), "NOSCRIPT") {
+		t.Errorf("Expected NOSCRIPT; Got %v", err)
+	}
+	sha, err := client.ScriptLoad(ctx, "return ARGV[1]").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := client.ScriptExists(ctx, sha).Result(); err != nil || !v[0] {
+		t.Errorf("Expected the script to exist; Got %v, %v", v, err)
+	}
+	if v, err := client.EvalSha(ctx, sha, nil, "x").Result(); err != nil || v != "x" {
+		t.Errorf("Expected x; Got %v, %v", v, err)
+	}
+}
+
+func equal(a, b interface{}) bool {
+	as, ok1 := a.([]interface{})
+	bs, ok2 := b.([]interface{})
+	if !ok1 || !ok2 {
+		return a == b
+	}
+	if len(as) != len(bs) {
+		return false
+	}
+	for i := range as {
+		if !equal(as[i], bs[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,326 @@
+/*
+Package redisserver provides an in-process Redis server for integration
+tests, so the real go-redis code path can be exercised without an external
+Redis.
+
+The server speaks RESP2 and RESP3 on a loopback port and implements the
+commands RediStore and its scripts use, with the semantics of Redis 7:
+
+	Connection: PING, ECHO, AUTH, HELLO, SELECT, CLIENT, QUIT, WAIT
+	Keys: DEL, UNLINK, EXISTS, EXPIRE, PEXPIRE, TTL, PTTL, PERSIST, TYPE,
+	  KEYS, SCAN, DBSIZE, FLUSHDB, FLUSHALL
+	Strings: GET, SET, SETEX, PSETEX, SETNX, GETDEL, MGET, INCR, INCRBY
+	Hashes: HSET, HSETNX, HGET, HGETALL, HDEL, HLEN
+	Sorted sets: ZADD, ZREM, ZCARD, ZSCORE, ZRANGE (by index)
+	Transactions: MULTI, EXEC, DISCARD
+	Scripting: EVAL, EVALSHA, SCRIPT LOAD, SCRIPT EXISTS, SCRIPT FLUSH
+	Pub/sub: SUBSCRIBE, UNSUBSCRIBE, PUBLISH
+
+Scripts run in Lua 5.1 with redis.call, redis.pcall, redis.status_reply and
+redis.error_reply. WATCH, pattern and sharded subscriptions, blocking
+commands and persistence are not supported.
+
+	srv, err := redisserver.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	store, err := redistore.NewRediStore([]string{srv.URL()}, false, []byte("secret-key"))
+
+This package does not import redistore, so redistore's own tests can use it.
+*/
+package redisserver
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// numDatabases is the number of databases SELECT can choose from.
+const numDatabases = 16
+
+// Server is an in-process Redis server listening on a loopback port.
+type Server struct {
+	ln net.Listener
+	wg sync.WaitGroup
+
+	// mu guards everything below. Commands run with it held, which makes
+	// them, transactions and scripts atomic.
+	mu       sync.Mutex
+	dbs      [numDatabases]*database
+	scripts  map[string]*lua.FunctionProto
+	password string
+	now      func() time.Time
+	conns    map[net.Conn]struct{}
+	nextID   int64
+	closed   bool
+	replicas int
+	channels map[string]map[*client]struct{} // subscribers by channel
+}
+
+// Start starts a server listening on a random loopback port.
+func Start() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		ln:       ln,
+		scripts:  make(map[string]*lua.FunctionProto),
+		now:      time.Now,
+		conns:    make(map[net.Conn]struct{}),
+		channels: make(map[string]map[*client]struct{}),
+	}
+	for i := range s.dbs {
+		s.dbs[i] = newDatabase()
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the host:port the server listens on.
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// URL returns a redis:// URL for the server, including the password if one
+// is set, as accepted by NewRediStore and redis.ParseURL.
+func (s *Server) URL() string {
+	u := url.URL{Scheme: "redis", Host: s.Addr()}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.password != "" {
+		u.User = url.UserPassword("", s.password)
+	}
+	return u.String()
+}
+
+// SetPassword requires clients to authenticate with AUTH or HELLO as the
+// default user with the given password. An empty password disables
+// authentication. Connections already authenticated stay so.
+func (s *Server) SetPassword(password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.password = password
+}
+
+// SetReplicas sets the number of replicas WAIT reports as having
+// acknowledged every write. There are no actual replicas, and WAIT answers
+// at once instead of waiting for its timeout. The default is 0.
+func (s *Server) SetReplicas(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replicas = n
+}
+
+// SetClock replaces the clock key expiry is measured with. The default is
+// time.Now; a fake clock lets tests expire keys without waiting.
+func (s *Server) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
+}
+
+// Keys returns the live keys of database db in sorted order.
+func (s *Server) Keys(db int) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dbs[db].keys(s.now(), "*")
+}
+
+// FlushAll removes every key of every database.
+func (s *Server) FlushAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.dbs {
+		s.dbs[i] = newDatabase()
+	}
+}
+
+// Close stops the server and closes all client connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	err := s.ln.Close()
+	for c := range s.conns {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.nextID++
+		c := &client{srv: s, id: s.nextID, proto: 2, authed: s.password == "", wake: make(chan struct{}, 1)}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go s.handle(conn, c)
+	}
+}
+
+// handle serves the requests of one connection.
+func (s *Server) handle(conn net.Conn, c *client) {
+	defer s.wg.Done()
+	done := make(chan struct{})
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		for channel := range c.channels {
+			c.unsubscribe(channel)
+		}
+		s.mu.Unlock()
+		close(done)
+		_ = conn.Close()
+	}()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	c.w = w
+	s.wg.Add(1)
+	go s.deliver(c, done)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				writeReply(w, redisError("ERR "+err.Error()), c.proto)
+				w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if !c.reply(args, r.Buffered() == 0) {
+			return
+		}
+	}
+}
+
+// reply runs a command and writes its reply, flushing it if flush is set or
+// the connection is to be closed. It reports whether to go on serving the
+// connection.
+func (c *client) reply(args []string, flush bool) bool {
+	s := c.srv
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	s.mu.Lock()
+	reply := c.dispatch(args)
+	s.mu.Unlock()
+	writeReply(c.w, reply, c.proto)
+	if c.quit {
+		c.w.Flush()
+		return false
+	}
+	// Flush once a pipeline has been read completely.
+	if flush {
+		return c.w.Flush() == nil
+	}
+	return true
+}
+
+// client is the state of one connection.
+type client struct {
+	srv    *Server
+	id     int64
+	db     int
+	proto  int
+	authed bool
+	quit   bool
+	script bool // running inside EVAL
+
+	multi bool
+	dirty bool
+	queue [][]string
+
+	// wmu guards w, which replies and pub/sub messages are written to.
+	wmu      sync.Mutex
+	w        *bufio.Writer
+	channels map[string]struct{} // subscribed channels
+	pending  []interface{}       // messages not delivered yet
+	wake     chan struct{}       // signaled when a message is pending
+}
+
+// dispatch runs a command, or queues it inside MULTI. The server lock is
+// held.
+func (c *client) dispatch(args []string) interface{} {
+	name := strings.ToLower(args[0])
+	cmd, ok := commands[name]
+	if !c.authed && (!ok || cmd.flags&flagNoAuth == 0) {
+		return redisError("NOAUTH Authentication required.")
+	}
+	if err := c.checkSubscribed(name); err != nil {
+		return err
+	}
+	if c.multi && name != "exec" && name != "discard" && name != "multi" {
+		if name == "subscribe" || name == "unsubscribe" {
+			c.dirty = true
+			return redisError("ERR Command not allowed inside a transaction")
+		}
+		if err := checkCommand(name, args); err != nil {
+			c.dirty = true
+			return err
+		}
+		c.queue = append(c.queue, args)
+		return status("QUEUED")
+	}
+	return c.call(args)
+}
+
+// checkCommand returns an error reply if args are not a known command with
+// the right number of arguments.
+func checkCommand(name string, args []string) interface{} {
+	cmd, ok := commands[name]
+	if !ok {
+		var b strings.Builder
+		for _, a := range args[1:] {
+			b.WriteString("'" + a + "' ")
+		}
+		return redisError("ERR unknown command '" + args[0] + "', with args beginning with: " + b.String())
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		return redisError("ERR wrong number of arguments for '" + name + "' command")
+	}
+	return nil
+}
+
+// call runs a command. The server lock is held.
+func (c *client) call(args []string) interface{} {
+	name := strings.ToLower(args[0])
+	if err := checkCommand(name, args); err != nil {
+		return err
+	}
+	cmd := commands[name]
+	if c.script && cmd.flags&flagNoScript != 0 {
+		return redisError("ERR This Redis command is not allowed from script")
+	}
+	return cmd.fn(c, args[1:])
+}
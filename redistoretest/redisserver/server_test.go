@@ -0,0 +1,262 @@
+package redisserver
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// start starts a server for the test and returns a client of the given
+// protocol version connected to it.
+func start(t *testing.T, proto int) (*Server, *redis.Client) {
+	t.Helper()
+	srv, err := Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := srv.Close(); err != nil {
+			fmt.Printf("Error closing server: %v\n", err)
+		}
+	})
+	opts, err := redis.ParseURL(srv.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Protocol = proto
+	client := redis.NewClient(opts)
+	t.Cleanup(func() {
+		if err := client.Close(); err != nil {
+			fmt.Printf("Error closing client: %v\n", err)
+		}
+	})
+	return srv, client
+}
+
+func TestServer(t *testing.T) {
+	for _, proto := range []int{2, 3} {
+		ctx := context.Background()
+		_, client := start(t, proto)
+		if v, err := client.Ping(ctx).Result(); err != nil || v != "PONG" {
+			t.Errorf("RESP%d: Expected PONG; Got %q, %v", proto, v, err)
+		}
+		if err := client.Set(ctx, "k", "v", 0).Err(); err != nil {
+			t.Fatalf("RESP%d: %v", proto, err)
+		}
+		if v, err := client.Get(ctx, "k").Result(); err != nil || v != "v" {
+			t.Errorf("RESP%d: Expected v; Got %q, %v", proto, v, err)
+		}
+		if _, err := client.Get(ctx, "missing").Result(); err != redis.Nil {
+			t.Errorf("RESP%d: Expected redis.Nil; Got %v", proto, err)
+		}
+		client.HSet(ctx, "h", "a", "1", "b", "2")
+		if v, err := client.HGetAll(ctx, "h").Result(); err != nil || len(v) != 2 || v["b"] != "2" {
+			t.Errorf("RESP%d: Expected the hash; Got %v, %v", proto, v, err)
+		}
+		if _, err := client.Get(ctx, "h").Result(); err == nil || !strings.HasPrefix(err.Error(), "WRONGTYPE") {
+			t.Errorf("RESP%d: Expected WRONGTYPE; Got %v", proto, err)
+		}
+		client.ZAdd(ctx, "z", redis.Z{Score: 2, Member: "b"}, redis.Z{Score: 1, Member: "a"})
+		if v, err := client.ZRangeWithScores(ctx, "z", 0, -1).Result(); err != nil || len(v) != 2 || v[0].Member != "a" || v[1].Score != 2 {
+			t.Errorf("RESP%d: Expected the sorted set; Got %v, %v", proto, v, err)
+		}
+		if v, err := client.ZScore(ctx, "z", "b").Result(); err != nil || v != 2 {
+			t.Errorf("RESP%d: Expected 2; Got %v, %v", proto, v, err)
+		}
+		if err := client.Do(ctx, "nosuchcommand").Err(); err == nil || !strings.Contains(err.Error(), "unknown command") {
+			t.Errorf("RESP%d: Expected an unknown command error; Got %v", proto, err)
+		}
+	}
+}
+
+func TestServerExpiry(t *testing.T) {
+	ctx := context.Background()
+	srv, client := start(t, 3)
+	now := time.Now()
+	var mu sync.Mutex
+	srv.SetClock(func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	})
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+
+	client.SetEx(ctx, "a", "1", time.Minute)
+	client.Set(ctx, "b", "2", 0)
+	if v := client.TTL(ctx, "a").Val(); v != time.Minute {
+		t.Errorf("Expected a TTL of 1m; Got %v", v)
+	}
+	if v := client.TTL(ctx, "b").Val(); v != -1 {
+		t.Errorf("Expected no TTL; Got %v", v)
+	}
+	if v := client.TTL(ctx, "c").Val(); v != -2 {
+		t.Errorf("Expected no key; Got %v", v)
+	}
+	client.Expire(ctx, "b", 2*time.Minute)
+	advance(time.Minute)
+	if v := client.Exists(ctx, "a", "b").Val(); v != 1 {
+		t.Errorf("Expected only b to exist; Got %d", v)
+	}
+	advance(time.Minute)
+	if keys := srv.Keys(0); len(keys) != 0 {
+		t.Errorf("Expected no keys; Got %v", keys)
+	}
+	if err := client.SetEx(ctx, "a", "1", 0).Err(); err == nil {
+		t.Error("Expected an invalid expire time error")
+	}
+}
+
+func TestServerScan(t *testing.T) {
+	ctx := context.Background()
+	srv, client := start(t, 2)
+	for _, k := range []string{"session_a", "session_b", "session_c", "other"} {
+		client.Set(ctx, k, "1", 0)
+	}
+	client.HSet(ctx, "session_a:meta", "seen", "1")
+
+	var keys []string
+	iter := client.Scan(ctx, 0, "session_*", 1).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		client.Del(ctx, "session_c") // deleted keys may be skipped, others not
+	}
+	if err := iter.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(keys, ",") != "session_a,session_b,session_a:meta" {
+		t.Errorf("Unexpected keys %v", keys)
+	}
+	if keys, _, err := client.ScanType(ctx, 0, "*", 100, "hash").Result(); err != nil || len(keys) != 1 {
+		t.Errorf("Expected one hash; Got %v, %v", keys, err)
+	}
+	if v := client.Keys(ctx, "session_[ab]*").Val(); strings.Join(v, ",") != "session_a,session_a:meta,session_b" {
+		t.Errorf("Unexpected keys %v", v)
+	}
+	if v := srv.Keys(0); len(v) != 4 {
+		t.Errorf("Expected 4 keys; Got %v", v)
+	}
+}
+
+func TestServerTransaction(t *testing.T) {
+	ctx := context.Background()
+	_, client := start(t, 3)
+	var incr *redis.IntCmd
+	_, err := client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Set(ctx, "n", "1", 0)
+		incr = p.Incr(ctx, "n")
+		return nil
+	})
+	if err != nil || incr.Val() != 2 {
+		t.Errorf("Expected 2; Got %d, %v", incr.Val(), err)
+	}
+	_, err = client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Incr(ctx, "n")
+		p.Do(ctx, "nosuchcommand")
+		return nil
+	})
+	if err == nil || client.Get(ctx, "n").Val() != "2" {
+		t.Errorf("Expected the transaction to be discarded; Got %v", err)
+	}
+}
+
+func TestServerWait(t *testing.T) {
+	ctx := context.Background()
+	srv, client := start(t, 3)
+	if n, err := client.Wait(ctx, 1, time.Second).Result(); err != nil || n != 0 {
+		t.Errorf("Expected 0 replicas; Got %d, %v", n, err)
+	}
+	srv.SetReplicas(2)
+	if n, err := client.Wait(ctx, 1, time.Second).Result(); err != nil || n != 2 {
+		t.Errorf("Expected 2 replicas; Got %d, %v", n, err)
+	}
+	if err := client.Do(ctx, "wait", 1, -1).Err(); err == nil {
+		t.Error("Expected a negative timeout to fail")
+	}
+}
+
+func TestServerAuth(t *testing.T) {
+	ctx := context.Background()
+	srv, err := Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := srv.Close(); err != nil {
+			fmt.Printf("Error closing server: %v\n", err)
+		}
+	}()
+	srv.SetPassword("secret")
+
+	for _, proto := range []int{2, 3} {
+		opts, _ := redis.ParseURL(srv.URL())
+		opts.Protocol = proto
+		client := redis.NewClient(opts)
+		if err := client.Ping(ctx).Err(); err != nil {
+			t.Errorf("RESP%d: Expected to authenticate; Got %v", proto, err)
+		}
+		if err := client.Close(); err != nil {
+			fmt.Printf("Error closing client: %v\n", err)
+		}
+
+		opts.Password = "wrong"
+		client = redis.NewClient(opts)
+		if err := client.Ping(ctx).Err(); err == nil {
+			t.Errorf("RESP%d: Expected a wrong password to fail", proto)
+		}
+		if err := client.Close(); err != nil {
+			fmt.Printf("Error closing client: %v\n", err)
+		}
+	}
+
+	// Raw connections get NOAUTH until they authenticate.
+	conn, err := net.Dial("tcp", srv.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			fmt.Printf("Error closing connection: %v\n", err)
+		}
+	}()
+	r := bufio.NewReader(conn)
+	for _, tc := range []struct{ send, want string }{
+		{"GET k\r\n", "-NOAUTH"},
+		{"AUTH secret\r\n", "+OK"},
+		{"*2\r\n$4\r\nECHO\r\n$2\r\nhi\r\n", "$2"},
+		{"SELECT 16\r\n", "-ERR DB index is out of range"},
+	} {
+		conn.Write([]byte(tc.send))
+		line, _ := r.ReadString('\n')
+		if !strings.HasPrefix(line, tc.want) {
+			t.Errorf("%q: Expected %q; Got %q", tc.send, tc.want, line)
+		}
+		if tc.want == "$2" {
+			r.ReadString('\n')
+		}
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	ctx := context.Background()
+	srv, client := start(t, 3)
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Ping(ctx).Err(); err == nil {
+		t.Error("Expected an error after Close")
+	}
+}
@@ -0,0 +1,339 @@
+/*
+Package redistoretest provides an in-memory stand-in for redistore.RediStore
+so code using sessions can be unit tested without Redis.
+
+Store implements sessions.Store with the behavior of RediStore: the same
+defaults, key prefix, maximum length, serializers, cookie encoding and TTLs,
+with expiry driven by a clock the test controls. Code written against the
+sessions.Store interface can be handed a Store in tests and a RediStore in
+production.
+
+	store := redistoretest.NewStore([]byte("secret-key"))
+	cookie, _ := store.SessionCookie("session-key", map[interface{}]interface{}{"user_id": 42})
+	req := httptest.NewRequest("GET", "/profile", nil)
+	req.AddCookie(cookie)
+*/
+package redistoretest
+
+import (
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/poseidonphp/redistore"
+)
+
+// sessionExpire is the default MaxAge of RediStore, 30 days.
+const sessionExpire = 86400 * 30
+
+// Store is an in-memory sessions.Store behaving like redistore.RediStore.
+// It is safe for concurrent use.
+//
+// Fields:
+//
+//	Codecs: A list of securecookie.Codec used to encode and decode session IDs.
+//	Options: Default configuration options for sessions.
+//	DefaultMaxAge: Default TTL for sessions with MaxAge == 0.
+type Store struct {
+	Codecs        []securecookie.Codec
+	Options       *sessions.Options
+	DefaultMaxAge int
+
+	mu         sync.Mutex
+	maxLength  int
+	keyPrefix  string
+	serializer redistore.SessionSerializer
+	now        func() time.Time
+	records    map[string]record
+}
+
+// record is a stored session payload.
+type record struct {
+	payload []byte
+	expires time.Time
+}
+
+// NewStore returns an empty Store with the defaults of RediStore and the
+// given key pairs for secure cookie encoding.
+func NewStore(keyPairs ...[]byte) *Store {
+	return &Store{
+		Codecs: securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{
+			Path:   "/",
+			MaxAge: sessionExpire,
+		},
+		DefaultMaxAge: 60 * 20,
+		maxLength:     4096,
+		keyPrefix:     "session_",
+		serializer:    redistore.GobSerializer{},
+		now:           time.Now,
+		records:       make(map[string]record),
+	}
+}
+
+// SetMaxLength restricts the maximum length of new sessions to l, as
+// RediStore.SetMaxLength. If l is 0 there is no limit.
+func (s *Store) SetMaxLength(l int) {
+	if l >= 0 {
+		s.maxLength = l
+	}
+}
+
+// SetKeyPrefix sets the prefix of the keys sessions are stored under.
+func (s *Store) SetKeyPrefix(p string) {
+	s.keyPrefix = p
+}
+
+// SetSerializer sets the session serializer.
+func (s *Store) SetSerializer(ss redistore.SessionSerializer) {
+	s.serializer = ss
+}
+
+// SetMaxAge sets the maximum age, in seconds, of sessions both in the store
+// and in the browser, as RediStore.SetMaxAge.
+func (s *Store) SetMaxAge(v int) {
+	s.Options.MaxAge = v
+	for _, c := range s.Codecs {
+		if sc, ok := c.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(v)
+		}
+	}
+}
+
+// SetClock replaces the clock session expiry is measured with. The default
+// is time.Now; a FakeClock lets tests expire sessions without waiting.
+func (s *Store) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *Store) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns a session for the given name without adding it to the
+// registry, loading it if the request carries a valid cookie for a live
+// session.
+func (s *Store) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	options := *s.Options
+	session.Options = &options
+	session.IsNew = true
+	c, errCookie := r.Cookie(name)
+	if errCookie != nil {
+		return session, nil
+	}
+	if err := securecookie.DecodeMulti(name, c.Value, &session.ID, s.Codecs...); err != nil {
+		return session, err
+	}
+	payload, ok := s.get(session.ID)
+	if !ok {
+		return session, nil
+	}
+	if err := s.serializer.Deserialize(payload, session); err != nil {
+		return session, err
+	}
+	session.IsNew = false
+	return session, nil
+}
+
+// Save stores the session and sets its cookie, or deletes it if its MaxAge
+// is negative or zero.
+func (s *Store) Save(_ *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge <= 0 {
+		s.Destroy(session.ID)
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+	if session.ID == "" {
+		session.ID = newSessionID()
+	}
+	if err := s.save(session); err != nil {
+		return err
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// Delete removes the session, expires its cookie and clears its values.
+func (s *Store) Delete(_ *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	s.Destroy(session.ID)
+	options := *session.Options
+	options.MaxAge = -1
+	http.SetCookie(w, sessions.NewCookie(session.Name(), "", &options))
+	for k := range session.Values {
+		delete(session.Values, k)
+	}
+	return nil
+}
+
+// Destroy removes the session with the given ID, reporting whether it was
+// live.
+func (s *Store) Destroy(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := s.keyPrefix + id
+	_, ok := s.records[key]
+	live := ok && !s.expiredLocked(key)
+	delete(s.records, key)
+	return live
+}
+
+// Load returns the values of the live session with the given ID.
+func (s *Store) Load(id string) (map[interface{}]interface{}, bool) {
+	payload, ok := s.get(id)
+	if !ok {
+		return nil, false
+	}
+	session := sessions.NewSession(s, "")
+	if err := s.serializer.Deserialize(payload, session); err != nil {
+		return nil, false
+	}
+	return session.Values, true
+}
+
+// TTL returns the remaining time to live of the session with the given ID,
+// or false if there is no such live session.
+func (s *Store) TTL(id string) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[s.keyPrefix+id]
+	if !ok || s.expiredLocked(s.keyPrefix+id) {
+		return 0, false
+	}
+	return rec.expires.Sub(s.now()), true
+}
+
+// Keys returns the keys of every live session in sorted order, including
+// the key prefix.
+func (s *Store) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for k := range s.records {
+		if !s.expiredLocked(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SessionCookie stores a new session with the given values and returns a
+// valid cookie for it, for adding to test requests.
+func (s *Store) SessionCookie(name string, values map[interface{}]interface{}) (*http.Cookie, error) {
+	session := sessions.NewSession(s, name)
+	options := *s.Options
+	session.Options = &options
+	for k, v := range values {
+		session.Values[k] = v
+	}
+	w := &headerWriter{header: make(http.Header)}
+	if err := s.Save(nil, w, session); err != nil {
+		return nil, err
+	}
+	return (&http.Response{Header: w.header}).Cookies()[0], nil
+}
+
+// EncodeCookie returns a cookie carrying the session ID encoded with codecs,
+// as RediStore and Store send it. It works with the Codecs of any store, so
+// tests can point requests at sessions they wrote directly.
+func EncodeCookie(name, id string, codecs ...securecookie.Codec) (*http.Cookie, error) {
+	encoded, err := securecookie.EncodeMulti(name, id, codecs...)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Cookie{Name: name, Value: encoded, Path: "/"}, nil
+}
+
+// save serializes and stores the session.
+func (s *Store) save(session *sessions.Session) error {
+	b, err := s.serializer.Serialize(session)
+	if err != nil {
+		return err
+	}
+	if s.maxLength != 0 && len(b) > s.maxLength {
+		return errors.New("SessionStore: the value to store is too big")
+	}
+	age := session.Options.MaxAge
+	if age == 0 {
+		age = s.DefaultMaxAge
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[s.keyPrefix+session.ID] = record{
+		payload: b,
+		expires: s.now().Add(time.Duration(age) * time.Second),
+	}
+	return nil
+}
+
+// get returns the payload of the live session with the given ID.
+func (s *Store) get(id string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := s.keyPrefix + id
+	if s.expiredLocked(key) {
+		delete(s.records, key)
+		return nil, false
+	}
+	rec, ok := s.records[key]
+	return rec.payload, ok
+}
+
+// expiredLocked reports whether the record under key has expired.
+func (s *Store) expiredLocked(key string) bool {
+	rec, ok := s.records[key]
+	return ok && !s.now().Before(rec.expires)
+}
+
+// newSessionID builds an alphanumeric session ID like RediStore's.
+func newSessionID() string {
+	return strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+}
+
+// headerWriter is the minimal http.ResponseWriter SessionCookie saves to.
+type headerWriter struct {
+	header http.Header
+}
+
+func (w *headerWriter) Header() http.Header         { return w.header }
+func (w *headerWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *headerWriter) WriteHeader(int)             {}
+
+// FakeClock is a manually advanced clock for Store.SetClock.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock returns a FakeClock set to start.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+// Now returns the current time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
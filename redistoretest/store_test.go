@@ -0,0 +1,140 @@
+package redistoretest
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/poseidonphp/redistore"
+)
+
+func TestStore(t *testing.T) {
+	store := NewStore([]byte("secret-key"))
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	store.SetClock(clock.Now)
+	var _ sessions.Store = store
+
+	// A new session is saved and loaded back through its cookie.
+	req := httptest.NewRequest("GET", "http://localhost/", nil)
+	session, err := store.Get(req, "session-key")
+	if err != nil || !session.IsNew {
+		t.Fatalf("Expected a new session; Got %v, %v", session.IsNew, err)
+	}
+	session.Values["foo"] = "bar"
+	session.Options.MaxAge = 60
+	rsp := httptest.NewRecorder()
+	if err := sessions.Save(req, rsp); err != nil {
+		t.Fatal(err)
+	}
+	cookie := rsp.Result().Cookies()[0]
+	if keys := store.Keys(); len(keys) != 1 || keys[0] != "session_"+session.ID {
+		t.Errorf("Expected one session key; Got %v", keys)
+	}
+	if ttl, ok := store.TTL(session.ID); !ok || ttl != time.Minute {
+		t.Errorf("Expected a TTL of 1m; Got %v, %v", ttl, ok)
+	}
+
+	req = httptest.NewRequest("GET", "http://localhost/", nil)
+	req.AddCookie(cookie)
+	loaded, err := store.New(req, "session-key")
+	if err != nil || loaded.IsNew || loaded.Values["foo"] != "bar" {
+		t.Errorf("Expected the saved session; Got %v, %v, %v", loaded.IsNew, loaded.Values, err)
+	}
+
+	// The session expires with the clock.
+	clock.Advance(time.Minute)
+	loaded, err = store.New(req, "session-key")
+	if err != nil || !loaded.IsNew || len(loaded.Values) != 0 {
+		t.Errorf("Expected the session to have expired; Got %v, %v, %v", loaded.IsNew, loaded.Values, err)
+	}
+	if keys := store.Keys(); len(keys) != 0 {
+		t.Errorf("Expected no keys; Got %v", keys)
+	}
+
+	// A negative MaxAge deletes the session.
+	session = sessions.NewSession(store, "session-key")
+	session.Options = &sessions.Options{MaxAge: 60}
+	session.Values["a"] = 1
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal(err)
+	}
+	session.Options.MaxAge = -1
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.Load(session.ID); ok {
+		t.Error("Expected the session to be deleted")
+	}
+
+	// A cookie from another key fails to decode.
+	other := NewStore([]byte("other-key"))
+	bad, err := other.SessionCookie("session-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = httptest.NewRequest("GET", "http://localhost/", nil)
+	req.AddCookie(bad)
+	if _, err := store.New(req, "session-key"); err == nil {
+		t.Error("Expected a decoding error")
+	}
+}
+
+func TestStoreOptions(t *testing.T) {
+	store := NewStore([]byte("secret-key"))
+	store.SetKeyPrefix("app_")
+	store.SetSerializer(redistore.JSONSerializer{})
+	store.SetMaxLength(32)
+
+	cookie, err := store.SessionCookie("session-key", map[interface{}]interface{}{"n": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := store.Keys(); len(keys) != 1 || !strings.HasPrefix(keys[0], "app_") {
+		t.Errorf("Expected an app_ key; Got %v", keys)
+	}
+	req := httptest.NewRequest("GET", "http://localhost/", nil)
+	req.AddCookie(cookie)
+	session, err := store.New(req, "session-key")
+	if err != nil || session.Values["n"] != float64(1) {
+		t.Errorf("Expected JSON values; Got %v, %v", session.Values, err)
+	}
+
+	_, err = store.SessionCookie("session-key", map[interface{}]interface{}{"big": strings.Repeat("x", 64)})
+	if err == nil || !strings.Contains(err.Error(), "too big") {
+		t.Errorf("Expected a too big error; Got %v", err)
+	}
+
+	rsp := httptest.NewRecorder()
+	if err := store.Delete(req, rsp, session); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.Keys()) != 0 || len(session.Values) != 0 {
+		t.Errorf("Expected the session to be deleted; Got %v, %v", store.Keys(), session.Values)
+	}
+	if c := rsp.Result().Cookies(); len(c) != 1 || c[0].MaxAge >= 0 {
+		t.Errorf("Expected an expired cookie; Got %v", c)
+	}
+}
+
+func TestEncodeCookie(t *testing.T) {
+	store := NewStore([]byte("secret-key"))
+	session := sessions.NewSession(store, "session-key")
+	session.Options = &sessions.Options{MaxAge: 60}
+	session.ID = "known"
+	session.Values["user_id"] = 7
+	if err := store.Save(nil, httptest.NewRecorder(), session); err != nil {
+		t.Fatal(err)
+	}
+	cookie, err := EncodeCookie("session-key", "known", store.Codecs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "http://localhost/", nil)
+	req.AddCookie(cookie)
+	loaded, err := store.New(req, "session-key")
+	if err != nil || loaded.ID != "known" || loaded.Values["user_id"] != 7 {
+		t.Errorf("Expected the known session; Got %q, %v, %v", loaded.ID, loaded.Values, err)
+	}
+}
@@ -0,0 +1,112 @@
+package redistore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ReadReplicaOptions configures reading sessions from replicas.
+//
+// Fields:
+//
+//	Client: The client sessions are read from: a ClusterClient created with
+//	  ReadOnly, RouteByLatency or RouteRandomly, or a client of a replica. It
+//	  is not closed by the store's Close.
+//	Window: How long after a session is saved or deleted by this store its
+//	  reads still go to the primary, covering the replication lag. Defaults
+//	  to 2 seconds.
+type ReadReplicaOptions struct {
+	Client redis.UniversalClient
+	Window time.Duration
+}
+
+// SetReadReplica routes session loads and SessionTTL to opts.Client, keeping
+// writes on the store's client. A nil opts, the default, reads from the
+// store's client.
+//
+// Reads are kept consistent with this store's own writes: a session saved or
+// deleted within opts.Window is read from the primary, and so is a session
+// the replica does not have, as when it was just created by another process.
+// Loads with revocation epochs enabled always read from the primary, so a
+// revocation takes effect immediately.
+func (s *RediStore) SetReadReplica(opts *ReadReplicaOptions) {
+	if opts == nil || opts.Client == nil {
+		s.replica = nil
+		return
+	}
+	window := opts.Window
+	if window <= 0 {
+		window = 2 * time.Second
+	}
+	s.replica = &replicaRouter{
+		client:  opts.Client,
+		window:  window,
+		now:     time.Now,
+		written: make(map[string]time.Time),
+		prune:   1024,
+	}
+}
+
+// replicaRouter picks the client a session is read from.
+type replicaRouter struct {
+	client redis.UniversalClient
+	window time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	written map[string]time.Time // session ID to the end of its window
+	prune   int                  // size of written that triggers pruning
+}
+
+// wrote starts the window of a session ID after a save or delete.
+func (rr *replicaRouter) wrote(id string) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	now := rr.now()
+	if len(rr.written) >= rr.prune {
+		for k, until := range rr.written {
+			if !now.Before(until) {
+				delete(rr.written, k)
+			}
+		}
+		rr.prune = max(1024, 2*len(rr.written))
+	}
+	rr.written[id] = now.Add(rr.window)
+}
+
+// recent reports whether a session ID is within its window.
+func (rr *replicaRouter) recent(id string) bool {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	until, ok := rr.written[id]
+	return ok && rr.now().Before(until)
+}
+
+// reader returns the client to read the session with the given ID from.
+func (s *RediStore) reader(id string) redis.UniversalClient {
+	if s.replica == nil || s.replica.recent(id) {
+		return s.Client
+	}
+	return s.replica.client
+}
+
+// wrote records a save or delete of the session with the given ID.
+func (s *RediStore) wrote(id string) {
+	if s.replica != nil {
+		s.replica.wrote(id)
+	}
+}
+
+// get reads the payload of the session with the given ID, from the primary
+// if the replica does not have it.
+func (s *RediStore) get(ctx context.Context, id string) (string, error) {
+	c := s.reader(id)
+	data, err := c.Get(ctx, s.keyPrefix+id).Result()
+	if err == redis.Nil && c != s.Client {
+		data, err = s.Client.Get(ctx, s.keyPrefix+id).Result()
+	}
+	return data, err
+}
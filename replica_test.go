@@ -0,0 +1,113 @@
+package redistore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestReadReplica(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewRediStore([]string{setup()}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	store.SetKeyPrefix("replica_test_")
+	defer purgeSessions(t, store)
+	opts, err := redis.ParseURL(startServer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica := redis.NewClient(opts)
+	defer func() {
+		if err := replica.Close(); err != nil {
+			fmt.Printf("Error closing client: %v\n", err)
+		}
+	}()
+	store.SetReadReplica(&ReadReplicaOptions{Client: replica, Window: time.Second})
+	now := time.Now()
+	store.replica.now = func() time.Time { return now }
+
+	req, err := saveValues(t, store, map[interface{}]interface{}{"n": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := store.New(req, "session-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := session.ID
+
+	// The replica lags behind with an older copy of the session.
+	stale := sessions.NewSession(store, "session-key")
+	stale.Values["n"] = 0
+	b, err := store.serializer.Serialize(stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := replica.Set(ctx, "replica_test_"+id, b, time.Minute).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Within the window of the save, reads go to the primary.
+	if session, err := store.New(req, "session-key"); err != nil || session.Values["n"] != 1 {
+		t.Errorf("Expected the saved session; Got %v, %v", session.Values, err)
+	}
+
+	// After it, reads go to the replica.
+	now = now.Add(time.Second)
+	if session, err := store.New(req, "session-key"); err != nil || session.Values["n"] != 0 {
+		t.Errorf("Expected the replica's session; Got %v, %v", session.Values, err)
+	}
+	if ttl, err := store.SessionTTL(ctx, id); err != nil || ttl > time.Minute {
+		t.Errorf("Expected the replica's TTL; Got %v, %v", ttl, err)
+	}
+
+	// Sessions missing on the replica are read from the primary.
+	replica.Del(ctx, "replica_test_"+id)
+	if session, err := store.New(req, "session-key"); err != nil || session.Values["n"] != 1 {
+		t.Errorf("Expected the saved session; Got %v, %v", session.Values, err)
+	}
+	if ttl, err := store.SessionTTL(ctx, id); err != nil || ttl <= time.Minute {
+		t.Errorf("Expected the primary's TTL; Got %v, %v", ttl, err)
+	}
+	if _, err := store.SessionTTL(ctx, "missing"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Expected ErrSessionNotFound; Got %v", err)
+	}
+
+	// Deletes start a window too.
+	if err := replica.Set(ctx, "replica_test_"+id, b, time.Minute).Err(); err != nil {
+		t.Fatal(err)
+	}
+	session.Options.MaxAge = -1
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal(err)
+	}
+	if session, err := store.New(req, "session-key"); err != nil || !session.IsNew {
+		t.Errorf("Expected the session to be gone; Got %v, %v", session.Values, err)
+	}
+}
+
+func TestReplicaRouterPrune(t *testing.T) {
+	rr := &replicaRouter{window: time.Second, written: make(map[string]time.Time), prune: 2}
+	now := time.Now()
+	rr.now = func() time.Time { return now }
+	rr.wrote("a")
+	rr.wrote("b")
+	now = now.Add(time.Second)
+	rr.wrote("c")
+	if len(rr.written) != 1 || !rr.recent("c") || rr.recent("a") {
+		t.Errorf("Expected only c to remain; Got %v", rr.written)
+	}
+}
@@ -0,0 +1,152 @@
+package redistore
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Operation identifies a session operation of a RediStore that a retry
+// policy applies to.
+type Operation string
+
+const (
+	// OpLoad reads a session in New.
+	OpLoad Operation = "load"
+	// OpSave writes a session in Save.
+	OpSave Operation = "save"
+	// OpDelete removes a session in Save or Delete.
+	OpDelete Operation = "delete"
+)
+
+// RetryPolicy configures how a RediStore retries session operations that
+// fail with transient errors, like the burst of failures during a failover.
+// It applies to whole operations, scripts and pipelines included, on top of
+// the command retries of the go-redis client.
+//
+// Fields:
+//
+//	MaxAttempts: Attempts per operation, the first one included. Defaults
+//	  to 3.
+//	BaseDelay: Backoff before the second attempt, doubled for every further
+//	  one. Defaults to 50 milliseconds.
+//	MaxDelay: Upper bound of the backoff. Defaults to 1 second.
+//	Retryable: Reports whether an error may be retried. Defaults to
+//	  IsTransientError.
+//	Idempotent: The operations that may be retried after an error that
+//	  leaves unknown whether Redis applied them, like a read timeout. Errors
+//	  raised before the command reached Redis, like a refused connection,
+//	  are retried for every operation. Defaults to all operations; leave
+//	  OpSave out when a delayed retry must not overwrite a newer save of the
+//	  same session by a concurrent request.
+//	Observe: Called, if set, when an operation completes, with the number
+//	  of attempts made and the final error, nil on success.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Retryable   func(err error) bool
+	Idempotent  []Operation
+	Observe     func(op Operation, attempts int, err error)
+}
+
+// SetRetryPolicy sets the retry policy of load, save and delete. A nil p
+// disables retries, the default.
+func (s *RediStore) SetRetryPolicy(p *RetryPolicy) {
+	if p == nil {
+		s.retry = nil
+		return
+	}
+	rp := *p
+	if rp.MaxAttempts <= 0 {
+		rp.MaxAttempts = 3
+	}
+	if rp.BaseDelay <= 0 {
+		rp.BaseDelay = 50 * time.Millisecond
+	}
+	if rp.MaxDelay <= 0 {
+		rp.MaxDelay = time.Second
+	}
+	if rp.MaxDelay < rp.BaseDelay {
+		rp.MaxDelay = rp.BaseDelay
+	}
+	if rp.Retryable == nil {
+		rp.Retryable = IsTransientError
+	}
+	if rp.Idempotent == nil {
+		rp.Idempotent = []Operation{OpLoad, OpSave, OpDelete}
+	}
+	s.retry = &rp
+}
+
+// withRetry runs fn for op under the retry policy of the store.
+func (s *RediStore) withRetry(op Operation, fn func() error) error {
+	p := s.retry
+	if p == nil {
+		return fn()
+	}
+	var err error
+	attempts := 0
+	for {
+		attempts++
+		err = fn()
+		if err == nil || attempts >= p.MaxAttempts || !p.retryable(op, err) {
+			break
+		}
+		time.Sleep(p.backoff(attempts))
+	}
+	if p.Observe != nil {
+		p.Observe(op, attempts, err)
+	}
+	return err
+}
+
+// retryable reports whether op may be retried after err.
+func (p *RetryPolicy) retryable(op Operation, err error) bool {
+	if !p.Retryable(err) {
+		return false
+	}
+	if !mayHaveApplied(err) {
+		return true
+	}
+	for _, o := range p.Idempotent {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the delay after the given number of failed attempts, drawn
+// from the upper half of the exponential backoff so that clients failing
+// together do not retry together.
+func (p *RetryPolicy) backoff(attempts int) time.Duration {
+	d := p.MaxDelay
+	if shift := attempts - 1; shift < 32 && p.BaseDelay<<shift < p.MaxDelay {
+		d = p.BaseDelay << shift
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// mayHaveApplied reports whether Redis may have executed the command that
+// failed with err. Refused connections, pool errors and error replies mean
+// it did not; timeouts and broken connections leave it unknown.
+func mayHaveApplied(err error) bool {
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, redis.ErrClosed),
+		errors.Is(err, redis.ErrPoolTimeout),
+		errors.Is(err, redis.ErrPoolExhausted):
+		return false
+	}
+	var oe *net.OpError
+	if errors.As(err, &oe) && oe.Op == "dial" {
+		return false
+	}
+	var re redis.Error
+	return !errors.As(err, &re)
+}
@@ -0,0 +1,150 @@
+package redistore
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// failFirst returns an outage that fails the first n commands named cmd
+// with err.
+func failFirst(n int, cmd string, err error) func(redis.Cmder) bool {
+	var mu sync.Mutex
+	return func(c redis.Cmder) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if c.Name() != cmd || n == 0 {
+			return false
+		}
+		n--
+		c.SetErr(err)
+		return true
+	}
+}
+
+// errTimeout is a read timeout, after which a command may have been applied.
+var errTimeout = &net.OpError{Op: "read", Net: "tcp", Err: timeoutErr{}}
+
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+type attempt struct {
+	op       Operation
+	attempts int
+	err      error
+}
+
+func TestRetryPolicy(t *testing.T) {
+	store, err := NewRediStore([]string{setup()}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	store.SetKeyPrefix("retry_test_")
+	defer purgeSessions(t, store)
+	hook := &outageHook{}
+	store.Client.AddHook(hook)
+	var observed []attempt
+	store.SetRetryPolicy(&RetryPolicy{
+		BaseDelay:  time.Millisecond,
+		Idempotent: []Operation{OpLoad, OpDelete},
+		Observe: func(op Operation, attempts int, err error) {
+			observed = append(observed, attempt{op, attempts, err})
+		},
+	})
+	last := func() attempt {
+		if len(observed) == 0 {
+			t.Fatal("Expected an observed operation")
+		}
+		return observed[len(observed)-1]
+	}
+
+	// Refused connections are retried for every operation.
+	hook.set(failFirst(2, "setex", errRefused))
+	req, err := saveValues(t, store, map[interface{}]interface{}{"user_id": 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := last(); a.op != OpSave || a.attempts != 3 || a.err != nil {
+		t.Errorf("Expected a save after 3 attempts; Got %+v", a)
+	}
+
+	// Timeouts are only retried for idempotent operations.
+	hook.set(failFirst(1, "get", errTimeout))
+	session, err := store.New(req, "session-key")
+	if err != nil || session.Values["user_id"] != 42 {
+		t.Errorf("Expected the saved session; Got %v, %v", session.Values, err)
+	}
+	if a := last(); a.op != OpLoad || a.attempts != 2 || a.err != nil {
+		t.Errorf("Expected a load after 2 attempts; Got %+v", a)
+	}
+	hook.set(failFirst(1, "setex", errTimeout))
+	if err := store.Save(req, httptest.NewRecorder(), session); !errors.Is(err, errTimeout) {
+		t.Errorf("Expected the timeout; Got %v", err)
+	}
+	if a := last(); a.op != OpSave || a.attempts != 1 || !errors.Is(a.err, errTimeout) {
+		t.Errorf("Expected a failed save after 1 attempt; Got %+v", a)
+	}
+
+	// The final error is returned once the attempts run out.
+	hook.set(failFirst(3, "del", errRefused))
+	session.Options.MaxAge = -1
+	if err := store.Save(req, httptest.NewRecorder(), session); !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Errorf("Expected connection refused; Got %v", err)
+	}
+	if a := last(); a.op != OpDelete || a.attempts != 3 || !errors.Is(a.err, syscall.ECONNREFUSED) {
+		t.Errorf("Expected a failed delete after 3 attempts; Got %+v", a)
+	}
+
+	// Without a policy, nothing is retried or observed.
+	store.SetRetryPolicy(nil)
+	n := len(observed)
+	hook.set(failFirst(1, "get", errRefused))
+	if _, err := store.New(req, "session-key"); err == nil {
+		t.Error("Expected the load to fail")
+	}
+	if len(observed) != n {
+		t.Errorf("Expected no observed operation; Got %+v", last())
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := &RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	for attempts, max := range map[int]time.Duration{1: 10, 2: 20, 3: 40, 4: 50, 40: 50} {
+		max *= time.Millisecond
+		for i := 0; i < 20; i++ {
+			if d := p.backoff(attempts); d < max/2 || d > max {
+				t.Errorf("backoff(%d): Expected between %v and %v; Got %v", attempts, max/2, max, d)
+			}
+		}
+	}
+}
+
+func TestMayHaveApplied(t *testing.T) {
+	for err, want := range map[error]bool{
+		errRefused:           false,
+		redis.ErrPoolTimeout: false,
+		redis.ErrClosed:      false,
+		errTimeout:           true,
+		errors.New("EOF"):    true,
+		&net.OpError{Op: "dial", Err: errTimeout}: false,
+	} {
+		if got := mayHaveApplied(err); got != want {
+			t.Errorf("mayHaveApplied(%v): Expected %v; Got %v", err, want, got)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package redistore
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SetRevocationEpochs enables revocation epochs. While enabled, the store
+// records the time each session was issued, and a session issued at or before
+// the global epoch set by RevokeSessions, or its user's epoch set by
+// RevokeUserSessions, is discarded on load and treated as new.
+//
+// Sessions saved before revocation was enabled have no issue time and are
+// considered revoked as soon as any applicable epoch is set.
+func (s *RediStore) SetRevocationEpochs(enabled bool) {
+	s.revocation = enabled
+}
+
+// RevokeSessions revokes every session issued at or before the given time.
+// It is a single SET of the global epoch, regardless of how many sessions the
+// store holds. Revocation epochs must be enabled with SetRevocationEpochs.
+func (s *RediStore) RevokeSessions(ctx context.Context, before time.Time) error {
+	if err := s.Client.Set(ctx, s.epochKey(), before.UnixMilli(), 0).Err(); err != nil {
+		return err
+	}
+	s.invalidate(ctx, "*")
+	return nil
+}
+
+// RevokeUserSessions revokes every session of userID issued at or before the
+// given time. Per-user epochs rely on the user index, so both
+// SetRevocationEpochs and SetUserIDFunc must be in use. The epoch expires
+// with the longer of Options.MaxAge and DefaultMaxAge, by which time every
+// session it applies to has expired as well.
+func (s *RediStore) RevokeUserSessions(ctx context.Context, userID string, before time.Time) error {
+	age := s.Options.MaxAge
+	if s.DefaultMaxAge > age {
+		age = s.DefaultMaxAge
+	}
+	key := s.userEpochKey(userTag(userID))
+	if err := s.Client.Set(ctx, key, before.UnixMilli(), time.Duration(age)*time.Second).Err(); err != nil {
+		return err
+	}
+	s.invalidate(ctx, "*")
+	return nil
+}
+
+// epochKey returns the key of the global revocation epoch.
+func (s *RediStore) epochKey() string {
+	return s.keyPrefix + "epoch:all"
+}
+
+// userEpochKey returns the key of the revocation epoch of the user identified
+// by tag. It shares the hash tag of the user's sessions.
+func (s *RediStore) userEpochKey(tag string) string {
+	return s.userIndexKey(tag) + ":epoch"
+}
+
+// loadUnrevoked reads the payload of the session stored under id from redis
+// together with its issue time and the applicable epochs, all in one round
+// trip. A revoked session is deleted and reported as not found and revoked,
+// so its ID is cleared and Save issues a new one.
+func (s *RediStore) loadUnrevoked(ctx context.Context, id string) (string, bool, error) {
+	var get, iat, all, user *redis.StringCmd
+	tag := idTag(id)
+	cmds, _ := s.Client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		get = p.Get(ctx, s.keyPrefix+id)
+		iat = p.HGet(ctx, s.metaKey(id), "iat")
+		all = p.Get(ctx, s.epochKey())
+		if tag != "" {
+			user = p.Get(ctx, s.userEpochKey(tag))
+		}
+		return nil
+	})
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil && !errors.Is(err, redis.Nil) {
+			return "", false, err
+		}
+	}
+	data := get.Val()
+	if data == "" {
+		return "", false, nil // no data was associated with this key
+	}
+
+	issued, _ := strconv.ParseInt(iat.Val(), 10, 64)
+	if revokedBy(issued, all) || (user != nil && revokedBy(issued, user)) {
+		// A single attempt: the load this is part of is retried as a whole.
+		defer s.wrote(id)
+		if _, err := s.deleteID(ctx, id); err != nil {
+			return "", false, err
+		}
+		return "", true, nil
+	}
+	return data, false, nil
+}
+
+// revokedBy reports whether a session issued at the given time, in unix
+// milliseconds, falls at or before the epoch returned by cmd.
+func revokedBy(issued int64, cmd *redis.StringCmd) bool {
+	epoch, err := strconv.ParseInt(cmd.Val(), 10, 64)
+	return err == nil && issued <= epoch
+}
@@ -0,0 +1,135 @@
+package redistore
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRevocationEpochs(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewRediStore([]string{setup()}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	store.SetKeyPrefix("revocation_test_")
+	store.SetUserIDFunc(UserIDFromValue("user_id"))
+	store.SetRevocationEpochs(true)
+	defer store.Client.Del(ctx, store.epochKey(), store.userEpochKey(userTag("erin")))
+	defer store.DestroyUserSessions(ctx, "erin")
+	defer store.DestroyUserSessions(ctx, "frank")
+
+	// get loads the session behind the cookie set in rsp.
+	get := func(rsp *httptest.ResponseRecorder) (string, bool) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+		req.Header.Add("Cookie", rsp.Header().Get("Set-Cookie"))
+		session, err := store.New(req, "session-key")
+		if err != nil {
+			t.Fatalf("Error getting session: %v", err)
+		}
+		return session.ID, !session.IsNew
+	}
+	save := func(uid string) *httptest.ResponseRecorder {
+		t.Helper()
+		req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+		session, _ := store.New(req, "session-key")
+		session.Values["user_id"] = uid
+		rsp := httptest.NewRecorder()
+		if err := store.Save(req, rsp, session); err != nil {
+			t.Fatalf("Error saving session: %v", err)
+		}
+		return rsp
+	}
+
+	erin, frank := save("erin"), save("frank")
+	if _, ok := get(erin); !ok {
+		t.Fatal("Expected session to load")
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	if err = store.RevokeUserSessions(ctx, "erin", time.Now()); err != nil {
+		t.Fatalf("Error revoking: %v", err)
+	}
+	if id, ok := get(erin); ok || id != "" {
+		t.Errorf("Expected erin's session to be revoked; Got %q, %v", id, ok)
+	}
+	if _, ok := get(frank); !ok {
+		t.Error("Expected frank's session to survive")
+	}
+	if ids, _ := store.ListUserSessions(ctx, "erin"); len(ids) != 0 {
+		t.Errorf("Expected revoked session to be deleted; Got %v", ids)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	later := save("erin")
+	if _, ok := get(later); !ok {
+		t.Error("Expected session issued after the epoch to load")
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	if err = store.RevokeSessions(ctx, time.Now()); err != nil {
+		t.Fatalf("Error revoking: %v", err)
+	}
+	if _, ok := get(frank); ok {
+		t.Error("Expected frank's session to be revoked")
+	}
+	if _, ok := get(later); ok {
+		t.Error("Expected erin's session to be revoked")
+	}
+}
+
+func TestRevokedSessionDeleteRetry(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewRediStore([]string{setup()}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	store.SetKeyPrefix("revocation_test_")
+	store.SetRevocationEpochs(true)
+	defer store.Client.Del(ctx, store.epochKey())
+	defer purgeSessions(t, store)
+	var attempts []attempt
+	store.SetRetryPolicy(&RetryPolicy{
+		BaseDelay: time.Millisecond,
+		Observe: func(op Operation, n int, err error) {
+			attempts = append(attempts, attempt{op, n, err})
+		},
+	})
+	req, err := saveValues(t, store, map[interface{}]interface{}{"n": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if err := store.RevokeSessions(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed delete of the revoked session retries the load, not the
+	// delete on its own.
+	hook := &outageHook{}
+	store.Client.AddHook(hook)
+	hook.set(failFirst(1, "del", errRefused))
+	defer hook.set(nil)
+	attempts = nil
+	session, err := store.New(req, "session-key")
+	if err != nil || !session.IsNew {
+		t.Fatalf("Expected a new session; Got %v", err)
+	}
+	if len(attempts) != 1 || attempts[0] != (attempt{OpLoad, 2, nil}) {
+		t.Errorf("Expected one load in 2 attempts; Got %v", attempts)
+	}
+}
@@ -0,0 +1,296 @@
+package redistore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/redis/go-redis/v9"
+)
+
+// registeredSession is a session got through Get, with a snapshot of it as
+// loaded or as last saved. There is no snapshot until SaveAll is first called
+// on the store, so that stores not using it do not pay for one on every Get.
+type registeredSession struct {
+	session  *sessions.Session
+	err      error
+	snapshot sessionSnapshot
+}
+
+// registeredSessions are the sessions got through Get for a request, by
+// name like the gorilla/sessions registry.
+type registeredSessions map[string]*registeredSession
+
+// register remembers a session got through Get for SaveAll. Like the
+// gorilla/sessions registry, it attaches itself to r in place, so that later
+// calls with the same request find it.
+func (s *RediStore) register(r *http.Request, session *sessions.Session, err error) {
+	if session == nil || session.Store() != s {
+		return
+	}
+	registered, ok := r.Context().Value(registeredContextKey).(registeredSessions)
+	if !ok {
+		registered = make(registeredSessions)
+		*r = *r.WithContext(context.WithValue(r.Context(), registeredContextKey, registered))
+	}
+	if _, ok := registered[session.Name()]; !ok {
+		reg := &registeredSession{session: session, err: err}
+		if s.saveAll.Load() {
+			reg.snapshot = takeSnapshot(s, session)
+		}
+		registered[session.Name()] = reg
+	}
+}
+
+// resnapshot takes a new snapshot of a session got through Get for r once it
+// is saved, so that SaveAll does not write it again unless it is modified
+// anew.
+func (s *RediStore) resnapshot(r *http.Request, session *sessions.Session) {
+	if r == nil || !s.saveAll.Load() {
+		return
+	}
+	registered, _ := r.Context().Value(registeredContextKey).(registeredSessions)
+	if reg := registered[session.Name()]; reg != nil && reg.session == session {
+		reg.snapshot = takeSnapshot(s, session)
+	}
+}
+
+// dirty returns the sessions of the store got through Get for r that were
+// modified since they were loaded, by name. Like with Middleware, sessions
+// that failed to load are left alone.
+func (s *RediStore) dirty(r *http.Request) []*registeredSession {
+	registered, _ := r.Context().Value(registeredContextKey).(registeredSessions)
+	names := make([]string, 0, len(registered))
+	for name := range registered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var dirty []*registeredSession
+	for _, name := range names {
+		reg := registered[name]
+		session := reg.session
+		if session.Store() != s || (reg.err != nil && session.ID != "") || !reg.snapshot.modified(s, session) {
+			continue
+		}
+		dirty = append(dirty, reg)
+	}
+	return dirty
+}
+
+// SaveAll saves the sessions of the store got through Get for the request
+// that were modified since they were loaded, deleting those marked for
+// deletion, in a single pipeline instead of a round trip per session. The
+// cookies are set once the pipeline has run. Sessions left unmodified are not
+// written, so their TTL is not extended; sessions.Save still saves them all.
+//
+// The pipeline is not a transaction, as the sessions may live on different
+// cluster nodes. A session whose writes failed gets no cookie and is
+// reported in the returned error, which wraps the error of every such
+// session; the others are saved all the same. A session written by SaveAll
+// counts as loaded again, so a second call does not write it anew.
+//
+// Sessions are only snapshotted on Get once SaveAll has been called on the
+// store, so stores that never use it pay nothing for it. Until then there is
+// nothing to compare with, and the first SaveAll of a request already under
+// way writes every session it got, as sessions.Save does.
+//
+// Sessions are saved one by one with Save when a save ack is required, since
+// replicas are waited for per session, and when the circuit breaker is not
+// closed, so that each session is a probe or falls back of its own, as with
+// Save. While it is closed, each session written by the pipeline counts as
+// a save of its own for the breaker. Giving a session of a user a new ID with
+// SetUserIDFunc deletes the records under its previous ID before the
+// pipeline runs.
+func (s *RediStore) SaveAll(r *http.Request, w http.ResponseWriter) error {
+	s.saveAll.Store(true)
+	dirty := s.dirty(r)
+	if len(dirty) == 0 {
+		return nil
+	}
+	if s.saveAck(r) != nil || (s.breaker != nil && !s.breaker.closed()) {
+		return s.saveEach(r, w, dirty)
+	}
+	return s.saveBatch(r, w, dirty)
+}
+
+// saveEach saves the sessions one by one.
+func (s *RediStore) saveEach(r *http.Request, w http.ResponseWriter, dirty []*registeredSession) error {
+	var errs []error
+	for _, reg := range dirty {
+		// Save takes a new snapshot of the session.
+		if err := s.Save(r, w, reg.session); err != nil {
+			errs = append(errs, saveAllError(reg.session, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// batchEntry is a session written by saveBatch.
+type batchEntry struct {
+	reg        *registeredSession
+	del        bool       // whether the session is deleted
+	data       []byte     // the serialized session
+	start, end int        // the range of its commands in the pipeline
+	save       *redis.Cmd // the indexed save script, if any
+}
+
+// saveBatch writes the sessions with a single pipeline and sets their
+// cookies.
+func (s *RediStore) saveBatch(r *http.Request, w http.ResponseWriter, dirty []*registeredSession) error {
+	ctx := context.Background()
+	var errs []error
+	batch := make([]*batchEntry, 0, len(dirty))
+	for _, reg := range dirty {
+		e, err := s.prepare(reg)
+		if err != nil {
+			errs = append(errs, saveAllError(reg.session, err))
+			continue
+		}
+		batch = append(batch, e)
+	}
+
+	var cmds []redis.Cmder
+	execErr := s.withRetry(OpSave, func() (err error) {
+		p := s.Client.Pipeline()
+		for _, e := range batch {
+			e.start = p.Len()
+			s.queueEntry(ctx, p, r, e)
+			e.end = p.Len()
+		}
+		cmds, err = p.Exec(ctx)
+		return err
+	})
+
+	ids := make([]string, 0, len(batch))
+	evicted := false
+	for _, e := range batch {
+		session := e.reg.session
+		if session.ID != "" {
+			ids = append(ids, session.ID)
+		}
+		err := execErr
+		if len(cmds) >= e.end {
+			var n int
+			n, err = s.batchResult(ctx, e, cmds[e.start:e.end])
+			evicted = evicted || n > 0
+		}
+		if s.breaker != nil {
+			s.breaker.done(err)
+		}
+		if err != nil {
+			errs = append(errs, saveAllError(session, err))
+			continue
+		}
+		value := ""
+		if !e.del {
+			if value, err = securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...); err != nil {
+				errs = append(errs, saveAllError(session, err))
+				continue
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), value, session.Options))
+		e.reg.snapshot = takeSnapshot(s, session)
+	}
+	// Failed writes may still have been applied.
+	for _, id := range ids {
+		s.wrote(id)
+	}
+	s.invalidate(ctx, ids...)
+	if evicted {
+		// The IDs of the evicted sessions are not known here.
+		s.invalidate(ctx, "*")
+	}
+	return errors.Join(errs...)
+}
+
+// prepare gives the session an ID and serializes it, unless it is marked for
+// deletion.
+func (s *RediStore) prepare(reg *registeredSession) (*batchEntry, error) {
+	session := reg.session
+	e := &batchEntry{reg: reg}
+	if session.Options.MaxAge <= 0 {
+		e.del = true
+		return e, nil
+	}
+	if s.userIDFunc != nil {
+		if err := s.retagID(session); err != nil {
+			return nil, err
+		}
+	} else if session.ID == "" {
+		session.ID = newSessionID()
+	}
+	b, err := s.serializer.Serialize(session)
+	if err != nil {
+		return nil, err
+	}
+	if s.maxLength != 0 && len(b) > s.maxLength {
+		return nil, errors.New("SessionStore: the value to store is too big")
+	}
+	e.data = b
+	return e, nil
+}
+
+// queueEntry adds the commands writing the session of e to p.
+func (s *RediStore) queueEntry(ctx context.Context, p redis.Pipeliner, r *http.Request, e *batchEntry) {
+	session := e.reg.session
+	id := session.ID
+	tag := idTag(id)
+	switch {
+	case e.del && id == "":
+		// Never stored; only the cookie is cleared.
+	case e.del && tag != "":
+		keys := []string{s.keyPrefix + id, s.userIndexKey(tag), s.userLRUKey(tag), s.metaKey(id)}
+		deleteIndexedScript.Eval(ctx, p, keys, id)
+	case e.del:
+		p.Del(ctx, s.keyPrefix+id)
+		p.Del(ctx, s.metaKey(id))
+	default:
+		age := session.Options.MaxAge
+		if tag != "" {
+			keys, args := s.saveIndexedArgs(session, e.data, age)
+			// EVALSHA could not fall back to EVAL within the pipeline.
+			e.save = saveIndexedScript.Eval(ctx, p, keys, args...)
+		} else {
+			p.SetEx(ctx, s.keyPrefix+id, e.data, time.Duration(age)*time.Second)
+		}
+		if s.revocation || s.metadata {
+			s.queueMeta(ctx, p, r, session, age)
+		}
+	}
+}
+
+// batchResult returns the error of the commands of e, and the number of
+// sessions its indexed save evicted.
+func (s *RediStore) batchResult(ctx context.Context, e *batchEntry, cmds []redis.Cmder) (int, error) {
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil {
+			return 0, err
+		}
+	}
+	if e.save == nil {
+		return 0, nil
+	}
+	n, err := e.save.Int()
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		session := e.reg.session
+		if s.revocation || s.metadata {
+			// The metadata was queued before the session was known to be rejected.
+			s.Client.Del(ctx, s.metaKey(session.ID))
+		}
+		return 0, &SessionLimitError{UserID: s.userIDFunc(session), Limit: s.maxUserSessions}
+	}
+	return n, nil
+}
+
+// saveAllError reports the failure of SaveAll to write a session.
+func saveAllError(session *sessions.Session, err error) error {
+	return fmt.Errorf("redistore: saving session %q: %w", session.Name(), err)
+}
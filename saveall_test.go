@@ -0,0 +1,227 @@
+package redistore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// roundTripHook counts the commands and pipelines sent to Redis.
+type roundTripHook struct {
+	cmds, pipelines atomic.Int32
+}
+
+func (h *roundTripHook) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (h *roundTripHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		h.cmds.Add(1)
+		return next(ctx, cmd)
+	}
+}
+
+func (h *roundTripHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		h.pipelines.Add(1)
+		return next(ctx, cmds)
+	}
+}
+
+// responseCookies returns the cookies set on rsp by name.
+func responseCookies(rsp *httptest.ResponseRecorder) map[string]*http.Cookie {
+	cookies := make(map[string]*http.Cookie)
+	for _, c := range rsp.Result().Cookies() {
+		cookies[c.Name] = c
+	}
+	return cookies
+}
+
+func TestSaveAll(t *testing.T) {
+	store, err := NewRediStore([]string{setup()}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	store.SetKeyPrefix("saveall_test_")
+	defer purgeSessions(t, store)
+	// Sessions are only snapshotted on Get once SaveAll is in use.
+	if err := store.SaveAll(httptest.NewRequest("GET", "http://localhost/", nil), httptest.NewRecorder()); err != nil {
+		t.Fatal(err)
+	}
+	req, err := saveValues(t, store, map[interface{}]interface{}{"n": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One session is deleted, two are created and one is left alone.
+	stored, err := store.Get(req, "session-key")
+	if err != nil || stored.IsNew {
+		t.Fatalf("Expected the saved session; Got %v", err)
+	}
+	stored.Options.MaxAge = -1
+	for name, n := range map[string]int{"a": 2, "b": 3} {
+		session, err := store.Get(req, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		session.Values["n"] = n
+	}
+	if _, err := store.Get(req, "c"); err != nil {
+		t.Fatal(err)
+	}
+
+	hook := &roundTripHook{}
+	store.Client.AddHook(hook)
+	rsp := httptest.NewRecorder()
+	if err := store.SaveAll(req, rsp); err != nil {
+		t.Fatal(err)
+	}
+	if cmds, pipelines := hook.cmds.Load(), hook.pipelines.Load(); cmds != 0 || pipelines != 1 {
+		t.Errorf("Expected a single pipeline; Got %d commands and %d pipelines", cmds, pipelines)
+	}
+	cookies := responseCookies(rsp)
+	if len(cookies) != 3 || cookies["c"] != nil {
+		t.Fatalf("Expected cookies for a, b and session-key; Got %v", cookies)
+	}
+	if c := cookies["session-key"]; c.MaxAge >= 0 {
+		t.Errorf("Expected an expired cookie; Got %v", c)
+	}
+	if _, err := store.Client.Get(context.Background(), "saveall_test_"+stored.ID).Result(); err != redis.Nil {
+		t.Errorf("Expected the session to be deleted; Got %v", err)
+	}
+	next := httptest.NewRequest("GET", "http://localhost/", nil)
+	next.AddCookie(cookies["a"])
+	next.AddCookie(cookies["b"])
+	for name, n := range map[string]int{"a": 2, "b": 3} {
+		session, err := store.New(next, name)
+		if err != nil || session.Values["n"] != n {
+			t.Errorf("Expected %s to hold %d; Got %v, %v", name, n, session.Values, err)
+		}
+	}
+
+	// Sessions written are not written again unless modified anew.
+	rsp = httptest.NewRecorder()
+	if err := store.SaveAll(req, rsp); err != nil {
+		t.Fatal(err)
+	}
+	if len(rsp.Result().Cookies()) != 0 || hook.pipelines.Load() != 1 {
+		t.Errorf("Expected nothing to be saved; Got %v", rsp.Result().Cookies())
+	}
+
+	// Neither are sessions saved with Save since.
+	a, err := store.Get(req, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Values["n"] = 4
+	if err := store.Save(req, httptest.NewRecorder(), a); err != nil {
+		t.Fatal(err)
+	}
+	cmds := hook.cmds.Load()
+	rsp = httptest.NewRecorder()
+	if err := store.SaveAll(req, rsp); err != nil {
+		t.Fatal(err)
+	}
+	if len(rsp.Result().Cookies()) != 0 || hook.cmds.Load() != cmds || hook.pipelines.Load() != 1 {
+		t.Errorf("Expected nothing to be saved; Got %v", rsp.Result().Cookies())
+	}
+}
+
+func TestSaveAllUserLimit(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewRediStore([]string{setup()}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	store.SetKeyPrefix("saveall_test_")
+	store.SetUserIDFunc(UserIDFromValue("user_id"))
+	store.SetMaxUserSessions(1, RejectNewSession)
+	store.SetSessionMetadata(true)
+	defer store.DestroyUserSessions(ctx, "7")
+	defer store.DestroyUserSessions(ctx, "8")
+	saveUserSession(t, store, 7)
+
+	req := httptest.NewRequest("GET", "http://localhost/", nil)
+	a, _ := store.Get(req, "a")
+	a.Values["user_id"] = 7
+	b, _ := store.Get(req, "b")
+	b.Values["user_id"] = 8
+	rsp := httptest.NewRecorder()
+	err = store.SaveAll(req, rsp)
+	var limitErr *SessionLimitError
+	if !errors.As(err, &limitErr) || limitErr.UserID != "7" {
+		t.Fatalf("Expected a SessionLimitError for user 7; Got %v", err)
+	}
+
+	// The session over the limit is not saved; the other one is.
+	cookies := responseCookies(rsp)
+	if len(cookies) != 1 || cookies["b"] == nil {
+		t.Fatalf("Expected a cookie for b only; Got %v", cookies)
+	}
+	if n, err := store.Client.Exists(ctx, store.metaKey(a.ID)).Result(); err != nil || n != 0 {
+		t.Errorf("Expected no metadata for the rejected session; Got %d, %v", n, err)
+	}
+	ids, err := store.ListUserSessions(ctx, "8")
+	if err != nil || len(ids) != 1 || ids[0] != b.ID {
+		t.Errorf("Expected [%s]; Got %v, %v", b.ID, ids, err)
+	}
+}
+
+func TestSaveAllCircuitBreaker(t *testing.T) {
+	store, hook, advance := breakerStore(t, &CircuitBreakerOptions{Threshold: 2, Cooldown: time.Minute})
+	get := func(req *http.Request, names ...string) {
+		t.Helper()
+		for _, name := range names {
+			session, err := store.Get(req, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			session.Values["n"] = 1
+		}
+	}
+
+	// Each session of the pipeline counts as a failed save.
+	req := httptest.NewRequest("GET", "http://localhost/", nil)
+	get(req, "a", "b")
+	hook.set(all)
+	if err := store.SaveAll(req, httptest.NewRecorder()); !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Errorf("Expected connection refused; Got %v", err)
+	}
+	if s := store.CircuitState(); s != CircuitOpen {
+		t.Fatalf("Expected the circuit to be open; Got %v", s)
+	}
+
+	// While it is not closed, sessions are saved one by one, the first one
+	// as the probe.
+	hook.set(nil)
+	advance(time.Minute)
+	req = httptest.NewRequest("GET", "http://localhost/", nil)
+	get(req, "c", "d")
+	rsp := httptest.NewRecorder()
+	if err := store.SaveAll(req, rsp); err != nil {
+		t.Fatal(err)
+	}
+	if cookies := responseCookies(rsp); len(cookies) != 2 {
+		t.Errorf("Expected cookies for c and d; Got %v", cookies)
+	}
+	if s := store.CircuitState(); s != CircuitClosed {
+		t.Errorf("Expected the circuit to be closed; Got %v", s)
+	}
+}
@@ -0,0 +1,301 @@
+package redistore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrSessionNotFound is returned by LookupSession, SessionTTL, DestroySession
+// and ExtendSession when no session is stored under the requested ID.
+var ErrSessionNotFound = errors.New("redistore: session not found")
+
+// ErrStopScan can be returned by a Scan callback to end the walk early.
+// Scan itself returns nil in that case.
+var ErrStopScan = errors.New("redistore: stop scan")
+
+// ScanOptions controls how Scan walks the keys held by a RediStore.
+//
+// Fields:
+//
+//	Load: Fetch and deserialize each session along with its remaining TTL and metadata.
+//	Count: The COUNT hint passed to SCAN. Zero leaves it to Redis.
+//	IDPrefix: Only visit sessions whose ID starts with this string.
+//	Raw: With Load, keep the serialized payload only and skip deserializing it.
+type ScanOptions struct {
+	Load     bool
+	Count    int64
+	IDPrefix string
+	Raw      bool
+}
+
+// SessionRecord describes a single session found by Scan.
+//
+// Fields:
+//
+//	ID: The session ID, i.e. the Redis key without the store's key prefix.
+//	Key: The full Redis key.
+//	TTL: Remaining time to live. Only set when ScanOptions.Load is true.
+//	Values: The deserialized session values. Only set when ScanOptions.Load is true
+//	  and ScanOptions.Raw is false.
+//	Metadata: The session metadata, if any. Only set when ScanOptions.Load is true.
+//	Raw: The serialized session as stored. Only set when ScanOptions.Load is true.
+type SessionRecord struct {
+	ID       string
+	Key      string
+	TTL      time.Duration
+	Values   map[interface{}]interface{}
+	Metadata *Metadata
+	Raw      []byte
+}
+
+// Scan walks every session key matching the store's key prefix using SCAN and
+// calls fn once per session. On a Redis Cluster every master is scanned, and on
+// a Ring every shard, so fn may observe sessions in any order but is never
+// called concurrently. Auxiliary records kept under the same prefix, such as
+// user indexes, are recognised by the colon following the prefix and skipped.
+//
+// Sessions that expire between the SCAN and the load are skipped. If fn returns
+// ErrStopScan the walk ends and Scan returns nil; any other error ends the walk
+// and is returned as is.
+func (s *RediStore) Scan(ctx context.Context, opts ScanOptions, fn func(*SessionRecord) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		stopped bool
+		fnErr   error
+	)
+	visit := func(ctx context.Context, c redis.Cmdable) error {
+		iter := c.Scan(ctx, 0, scanPattern(s.keyPrefix+opts.IDPrefix), opts.Count).Iterator()
+		for iter.Next(ctx) {
+			key := iter.Val()
+			id := strings.TrimPrefix(key, s.keyPrefix)
+			if strings.Contains(id, ":") {
+				continue
+			}
+			rec := &SessionRecord{ID: id, Key: key}
+			if opts.Load {
+				found, err := s.loadRecord(ctx, rec, !opts.Raw)
+				if err != nil {
+					return err
+				}
+				if !found {
+					continue
+				}
+			}
+			mu.Lock()
+			if stopped {
+				mu.Unlock()
+				return nil
+			}
+			if err := fn(rec); err != nil {
+				stopped = true
+				if !errors.Is(err, ErrStopScan) {
+					fnErr = err
+				}
+				mu.Unlock()
+				cancel()
+				return nil
+			}
+			mu.Unlock()
+		}
+		return iter.Err()
+	}
+
+	var err error
+	switch c := s.Client.(type) {
+	case *redis.ClusterClient:
+		err = c.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return visit(ctx, node)
+		})
+	case *redis.Ring:
+		err = c.ForEachShard(ctx, func(ctx context.Context, shard *redis.Client) error {
+			return visit(ctx, shard)
+		})
+	default:
+		err = visit(ctx, c)
+	}
+
+	if fnErr != nil {
+		return fnErr
+	}
+	if stopped {
+		return nil
+	}
+	return err
+}
+
+// LookupSession loads the session stored under id together with its TTL and
+// metadata. It returns ErrSessionNotFound if no such session exists.
+func (s *RediStore) LookupSession(ctx context.Context, id string) (*SessionRecord, error) {
+	return s.lookupSession(ctx, id, true)
+}
+
+// lookupSession loads the session stored under id, deserializing its values
+// if decode is set.
+func (s *RediStore) lookupSession(ctx context.Context, id string, decode bool) (*SessionRecord, error) {
+	rec := &SessionRecord{ID: id, Key: s.keyPrefix + id}
+	found, err := s.loadRecord(ctx, rec, decode)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrSessionNotFound
+	}
+	return rec, nil
+}
+
+// SessionTTL returns the remaining lifetime of the session stored under id.
+// It returns ErrSessionNotFound if no such session exists.
+func (s *RediStore) SessionTTL(ctx context.Context, id string) (time.Duration, error) {
+	c := s.reader(id)
+	ttl, err := c.PTTL(ctx, s.keyPrefix+id).Result()
+	if err == nil && ttl == -2 && c != s.Client {
+		ttl, err = s.Client.PTTL(ctx, s.keyPrefix+id).Result()
+	}
+	if err != nil {
+		return 0, err
+	}
+	// go-redis reports a missing key as a raw -2.
+	if ttl == -2 {
+		return 0, ErrSessionNotFound
+	}
+	return ttl, nil
+}
+
+// DestroySession deletes the session stored under id along with its metadata
+// and index entries. It returns ErrSessionNotFound if no such session exists.
+func (s *RediStore) DestroySession(ctx context.Context, id string) error {
+	found, err := s.deleteID(ctx, id)
+	if err == nil && !found {
+		err = ErrSessionNotFound
+	}
+	return err
+}
+
+// ExtendSession sets the remaining lifetime of the session stored under id,
+// and of its metadata, to ttl. The cookie held by the browser is not
+// affected. It returns ErrSessionNotFound if no such session exists.
+func (s *RediStore) ExtendSession(ctx context.Context, id string, ttl time.Duration) error {
+	secs := int64(ttl / time.Second)
+	if secs <= 0 {
+		return errors.New("redistore: extend TTL must be at least one second")
+	}
+	var found bool
+	if tag := idTag(id); tag != "" {
+		keys := []string{s.keyPrefix + id, s.userIndexKey(tag), s.userLRUKey(tag), s.metaKey(id)}
+		n, err := extendIndexedScript.Run(ctx, s.Client, keys, secs).Int()
+		if err != nil {
+			return err
+		}
+		found = n > 0
+	} else {
+		var expire *redis.BoolCmd
+		if _, err := s.Client.Pipelined(ctx, func(p redis.Pipeliner) error {
+			expire = p.Expire(ctx, s.keyPrefix+id, time.Duration(secs)*time.Second)
+			p.Expire(ctx, s.metaKey(id), time.Duration(secs)*time.Second)
+			return nil
+		}); err != nil {
+			return err
+		}
+		found = expire.Val()
+	}
+	if !found {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// UserSessionRecords loads the live sessions belonging to userID, oldest
+// first, with their TTL and metadata. It requires the user index enabled with
+// SetUserIDFunc.
+func (s *RediStore) UserSessionRecords(ctx context.Context, userID string) ([]*SessionRecord, error) {
+	return s.userSessionRecords(ctx, userID, true)
+}
+
+// UserSessionRecordsRaw is like UserSessionRecords but leaves the values of
+// the sessions undecoded, as with ScanOptions.Raw: only their payload, TTL
+// and metadata are loaded, and a session that cannot be deserialized is
+// still returned.
+func (s *RediStore) UserSessionRecordsRaw(ctx context.Context, userID string) ([]*SessionRecord, error) {
+	return s.userSessionRecords(ctx, userID, false)
+}
+
+// userSessionRecords loads the live sessions belonging to userID,
+// deserializing their values if decode is set.
+func (s *RediStore) userSessionRecords(ctx context.Context, userID string, decode bool) ([]*SessionRecord, error) {
+	ids, err := s.ListUserSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	recs := make([]*SessionRecord, 0, len(ids))
+	for _, id := range ids {
+		rec, err := s.lookupSession(ctx, id, decode)
+		if errors.Is(err, ErrSessionNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+// loadRecord fills in the TTL, payload and metadata of rec, and its values if
+// decode is set. It reports false if the key no longer exists. The session and
+// its metadata may live on different cluster nodes, so it always goes through
+// the store's client.
+func (s *RediStore) loadRecord(ctx context.Context, rec *SessionRecord, decode bool) (bool, error) {
+	var get *redis.StringCmd
+	var ttl *redis.DurationCmd
+	var meta *redis.MapStringStringCmd
+	cmds, _ := s.Client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		get = p.Get(ctx, rec.Key)
+		ttl = p.PTTL(ctx, rec.Key)
+		meta = p.HGetAll(ctx, s.metaKey(rec.ID))
+		return nil
+	})
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil && !errors.Is(err, redis.Nil) {
+			return false, err
+		}
+	}
+	if get.Err() != nil {
+		return false, nil
+	}
+	rec.Raw = []byte(get.Val())
+	rec.TTL = ttl.Val()
+	rec.Metadata = parseMetadata(meta.Val())
+	if decode {
+		session := sessions.NewSession(s, "")
+		session.ID = rec.ID
+		if err := s.serializer.Deserialize(rec.Raw, session); err != nil {
+			return false, err
+		}
+		rec.Values = session.Values
+	}
+	return true, nil
+}
+
+// scanPattern returns a SCAN MATCH pattern selecting every key that starts
+// with prefix, escaping any glob metacharacters the prefix contains.
+func scanPattern(prefix string) string {
+	var b strings.Builder
+	for _, r := range prefix {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('*')
+	return b.String()
+}
@@ -0,0 +1,97 @@
+package redistore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestScan(t *testing.T) {
+	store, err := NewRediStore([]string{setup()}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	store.SetKeyPrefix("scan_test[1]_")
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	ids := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		session, err := store.New(req, "session-key")
+		if err != nil {
+			t.Fatalf("Error getting session: %v", err)
+		}
+		session.Values["n"] = i
+		if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+			t.Fatalf("Error saving session: %v", err)
+		}
+		ids[session.ID] = true
+	}
+	defer func() {
+		for id := range ids {
+			store.Client.Del(context.Background(), "scan_test[1]_"+id)
+		}
+	}()
+
+	seen := make(map[string]bool)
+	err = store.Scan(context.Background(), ScanOptions{Load: true}, func(rec *SessionRecord) error {
+		if !ids[rec.ID] {
+			t.Errorf("Unexpected session %q", rec.ID)
+		}
+		if rec.TTL <= 0 || rec.TTL > time.Duration(sessionExpire)*time.Second {
+			t.Errorf("Unexpected TTL %v", rec.TTL)
+		}
+		if _, ok := rec.Values["n"]; !ok {
+			t.Errorf("Expected values to be loaded; Got %v", rec.Values)
+		}
+		seen[rec.ID] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error scanning: %v", err)
+	}
+	if len(seen) != len(ids) {
+		t.Errorf("Expected %d sessions; Got %d", len(ids), len(seen))
+	}
+
+	calls := 0
+	err = store.Scan(context.Background(), ScanOptions{}, func(rec *SessionRecord) error {
+		calls++
+		if rec.Values != nil {
+			t.Errorf("Expected values not to be loaded; Got %v", rec.Values)
+		}
+		return ErrStopScan
+	})
+	if err != nil || calls != 1 {
+		t.Errorf("Expected a single call and no error; Got %d calls, %v", calls, err)
+	}
+
+	boom := errors.New("boom")
+	err = store.Scan(context.Background(), ScanOptions{}, func(*SessionRecord) error {
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Errorf("Expected callback error; Got %v", err)
+	}
+}
+
+func TestScanPattern(t *testing.T) {
+	tests := map[string]string{
+		"session_":   "session_*",
+		"a*b?[c]\\_": "a\\*b\\?\\[c\\]\\\\_*",
+		"":           "*",
+	}
+	for in, want := range tests {
+		if got := scanPattern(in); got != want {
+			t.Errorf("scanPattern(%q) = %q; want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+module generate
+
+go 1.23
+
+require (
+	github.com/alicebob/miniredis/v2 v2.37.0
+	github.com/boj/redistore v0.0.0-20180917114910-cd5dcc76aeff
+)
+
+require (
+	github.com/gomodule/redigo v2.0.0+incompatible // indirect
+	github.com/gorilla/securecookie v1.1.2 // indirect
+	github.com/gorilla/sessions v1.2.2 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+)
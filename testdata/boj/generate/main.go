@@ -0,0 +1,98 @@
+// Command generate writes the golden fixtures in ../fixtures.json using the
+// original boj/redistore against an in-memory Redis server. It is a separate
+// module so the main module does not depend on redigo.
+//
+//	cd testdata/boj/generate && go run . > ../fixtures.json
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http/httptest"
+	"os"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/boj/redistore"
+)
+
+// fixture is a session saved by boj/redistore.
+type fixture struct {
+	Name        string `json:"name"`
+	Serializer  string `json:"serializer"`
+	HashKey     string `json:"hash_key"`
+	BlockKey    string `json:"block_key,omitempty"`
+	SessionName string `json:"session_name"`
+	ID          string `json:"id"`
+	Key         string `json:"key"`
+	Record      string `json:"record"`
+	SetCookie   string `json:"set_cookie"`
+}
+
+func main() {
+	m := miniredis.NewMiniRedis()
+	if err := m.Start(); err != nil {
+		log.Fatal(err)
+	}
+	defer m.Close()
+
+	const (
+		hashKey  = "boj-compat-hash-key-0123456789ab"
+		blockKey = "boj-compat-block-key-0123456789a"
+	)
+	var out []fixture
+	for _, c := range []struct{ name, serializer, blockKey string }{
+		{"gob-signed", "gob", ""},
+		{"gob-encrypted", "gob", blockKey},
+		{"json-signed", "json", ""},
+	} {
+		keyPairs := [][]byte{[]byte(hashKey)}
+		if c.blockKey != "" {
+			keyPairs = append(keyPairs, []byte(c.blockKey))
+		}
+		store, err := redistore.NewRediStore(10, "tcp", m.Addr(), "", keyPairs...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if c.serializer == "json" {
+			store.SetSerializer(redistore.JSONSerializer{})
+		}
+
+		req := httptest.NewRequest("GET", "http://localhost/", nil)
+		session, err := store.Get(req, "boj-session")
+		if err != nil {
+			log.Fatal(err)
+		}
+		session.Values["user"] = "gopher"
+		session.Values["visits"] = 3
+		session.AddFlash("welcome back")
+		rsp := httptest.NewRecorder()
+		if err := session.Save(req, rsp); err != nil {
+			log.Fatal(err)
+		}
+		record, err := m.Get("session_" + session.ID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		out = append(out, fixture{
+			Name:        c.name,
+			Serializer:  c.serializer,
+			HashKey:     hashKey,
+			BlockKey:    c.blockKey,
+			SessionName: session.Name(),
+			ID:          session.ID,
+			Key:         "session_" + session.ID,
+			Record:      base64.StdEncoding.EncodeToString([]byte(record)),
+			SetCookie:   rsp.Header().Get("Set-Cookie"),
+		})
+		if err := store.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		log.Fatal(err)
+	}
+}
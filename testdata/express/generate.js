@@ -0,0 +1,39 @@
+#!/usr/bin/env node
+// Writes fixtures.json the way express-session and connect-redis do: the
+// cookie is signed like cookie-signature's sign() and encoded like
+// cookie.serialize(), the record is JSON.stringify() of the session.
+//
+//   cd testdata/express && node generate.js > fixtures.json
+'use strict';
+const crypto = require('crypto');
+
+const secret = 'keyboard cat';
+const id = 'Xr4nD0mS3ss10nIdFr0mUidSafe_-AbC';
+
+// cookie-signature sign()
+function sign(val, secret) {
+  return val + '.' + crypto.createHmac('sha256', secret).update(val).digest('base64').replace(/=+$/, '');
+}
+
+const session = {
+  cookie: {
+    originalMaxAge: 7 * 24 * 60 * 60 * 1000,
+    expires: new Date(Date.UTC(2030, 0, 2, 3, 4, 5, 678)),
+    secure: true,
+    httpOnly: true,
+    domain: 'example.com',
+    path: '/app',
+    sameSite: 'strict',
+  },
+  passport: { user: '42' },
+  views: 3,
+  flash: {},
+};
+
+process.stdout.write(JSON.stringify({
+  secret: secret,
+  cookie_name: 'connect.sid',
+  id: id,
+  cookie: encodeURIComponent('s:' + sign(id, secret)),
+  record: JSON.stringify(session),
+}, null, 2) + '\n');
@@ -0,0 +1,57 @@
+#!/usr/bin/env python3
+"""Writes fixtures.json the way Laravel's Encrypter, EncryptCookies and
+cache based session handler do, using the openssl CLI for AES-256-CBC like
+PHP's openssl_encrypt.
+
+    cd testdata/laravel && ./generate.py > fixtures.json
+"""
+import base64
+import hashlib
+import hmac
+import json
+import subprocess
+import urllib.parse
+
+KEY = bytes(range(32))
+APP_KEY = "base64:" + base64.b64encode(KEY).decode()
+COOKIE_NAME = "laravel_session"
+SESSION_ID = "Zl4kq0Rj7n2Vd8cXyB1aPqW3eT5uI9oLmN6bK0hG"
+TOKEN = "aB3dE5fG7hJ9kL1mN3pQ5rS7tU9vW1xY3zA5bC7d"
+
+
+def php_string(s):
+    return 's:%d:"%s";' % (len(s.encode()), s)
+
+
+def encrypt(plain, iv):
+    value = subprocess.run(
+        ["openssl", "enc", "-aes-256-cbc", "-K", KEY.hex(), "-iv", iv.hex(), "-base64", "-A"],
+        input=plain.encode(), capture_output=True, check=True).stdout.decode()
+    iv64 = base64.b64encode(iv).decode()
+    mac = hmac.new(KEY, (iv64 + value).encode(), hashlib.sha256).hexdigest()
+    envelope = json.dumps({"iv": iv64, "value": value, "mac": mac, "tag": ""}, separators=(",", ":"))
+    return base64.b64encode(envelope.encode()).decode()
+
+
+prefix = hmac.new(KEY, (COOKIE_NAME + "v2").encode(), hashlib.sha1).hexdigest() + "|"
+cookie = urllib.parse.quote_plus(encrypt(prefix + SESSION_ID, bytes(range(16, 32))))
+
+login = "login_web_" + hashlib.sha1(b"web").hexdigest()
+# Keys in sorted order, as PHPSessionSerializer writes them.
+attributes = (
+    "a:4:{" + php_string("_flash") + "a:2:{" + php_string("new") + "a:0:{}" + php_string("old") + "a:0:{}}"
+    + php_string("_previous") + "a:1:{" + php_string("url") + php_string("http://localhost/login") + "}"
+    + php_string("_token") + php_string(TOKEN)
+    + php_string(login) + "i:42;}"
+)
+
+print(json.dumps({
+    "app_key": APP_KEY,
+    "cookie_name": COOKIE_NAME,
+    "cookie": cookie,
+    "id": SESSION_ID,
+    "token": TOKEN,
+    "login_key": login,
+    "record": php_string(attributes),
+    "encrypted_record": php_string(encrypt(php_string(attributes), bytes(range(32, 48)))),
+}, indent=2))
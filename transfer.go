@@ -0,0 +1,157 @@
+package redistore
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/redis/go-redis/v9"
+)
+
+// TransferOptions controls Export and Import.
+//
+// Fields:
+//
+//	Decode: Export the deserialized values instead of the raw payload. This
+//	  lets sessions move between serializers, but values come back as JSON
+//	  types (strings, float64, maps) and non-string keys as strings.
+//	DryRun: Import validates every record without writing anything.
+//	Progress: Called after each session is exported or imported with the
+//	  number of sessions handled so far.
+type TransferOptions struct {
+	Decode   bool
+	DryRun   bool
+	Progress func(n int)
+}
+
+// TransferRecord is a single line of the JSON Lines format read by Import and
+// written by Export. Exactly one of Payload and Values is set; Payload is
+// base64 encoded in JSON.
+type TransferRecord struct {
+	ID        string                 `json:"id"`
+	TTLMillis int64                  `json:"ttl_ms"`
+	Metadata  *Metadata              `json:"metadata,omitempty"`
+	Payload   []byte                 `json:"payload,omitempty"`
+	Values    map[string]interface{} `json:"values,omitempty"`
+}
+
+// Export writes every session in the store to w as JSON Lines, one
+// TransferRecord per session, and returns the number of sessions written.
+func (s *RediStore) Export(ctx context.Context, w io.Writer, opts TransferOptions) (int, error) {
+	n := 0
+	enc := json.NewEncoder(w)
+	err := s.Scan(ctx, ScanOptions{Load: true, Raw: !opts.Decode}, func(rec *SessionRecord) error {
+		out := TransferRecord{
+			ID:        rec.ID,
+			TTLMillis: rec.TTL.Milliseconds(),
+			Metadata:  rec.Metadata,
+		}
+		if opts.Decode {
+			out.Values = make(map[string]interface{}, len(rec.Values))
+			for k, v := range rec.Values {
+				out.Values[fmt.Sprint(k)] = v
+			}
+		} else {
+			out.Payload = rec.Raw
+		}
+		if err := enc.Encode(out); err != nil {
+			return fmt.Errorf("redistore: exporting session %s: %w", rec.ID, err)
+		}
+		n++
+		if opts.Progress != nil {
+			opts.Progress(n)
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Import reads sessions written by Export from r and stores them under this
+// store's key prefix, keeping their IDs, remaining TTLs and metadata, and
+// returns the number of sessions imported. Records without a TTL get
+// DefaultMaxAge. Decoded values are serialized with the store's serializer.
+// Sessions of indexed users are added to the user index.
+//
+// Import stops at the first invalid record; sessions imported before it are
+// kept. With DryRun set every record is validated and nothing is written.
+func (s *RediStore) Import(ctx context.Context, r io.Reader, opts TransferOptions) (int, error) {
+	n := 0
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var rec TransferRecord
+		err := dec.Decode(&rec)
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		}
+		if err != nil {
+			return n, fmt.Errorf("redistore: reading record %d: %w", n+1, err)
+		}
+		if err := s.importRecord(ctx, &rec, opts.DryRun); err != nil {
+			return n, fmt.Errorf("redistore: importing session %q: %w", rec.ID, err)
+		}
+		n++
+		if opts.Progress != nil {
+			opts.Progress(n)
+		}
+	}
+}
+
+// importRecord validates rec and, unless dryRun is set, stores it.
+func (s *RediStore) importRecord(ctx context.Context, rec *TransferRecord, dryRun bool) error {
+	if rec.ID == "" {
+		return errors.New("missing session ID")
+	}
+	payload := rec.Payload
+	if payload == nil {
+		if rec.Values == nil {
+			return errors.New("record has neither payload nor values")
+		}
+		session := sessions.NewSession(s, "")
+		for k, v := range rec.Values {
+			session.Values[k] = v
+		}
+		var err error
+		if payload, err = s.serializer.Serialize(session); err != nil {
+			return err
+		}
+	}
+	if dryRun {
+		return nil
+	}
+
+	age := s.DefaultMaxAge
+	if rec.TTLMillis > 0 {
+		// Round up so a session about to expire is not imported without a TTL.
+		age = int((rec.TTLMillis + 999) / 1000)
+	}
+	key := s.keyPrefix + rec.ID
+	var err error
+	if tag := idTag(rec.ID); tag != "" {
+		keys := []string{key, s.userIndexKey(tag), s.userLRUKey(tag)}
+		err = saveIndexedScript.Run(ctx, s.Client, keys, payload, age, rec.ID, time.Now().UnixMilli(), s.keyPrefix, 0, 0).Err()
+	} else {
+		err = s.Client.SetEx(ctx, key, payload, time.Duration(age)*time.Second).Err()
+	}
+	s.invalidate(ctx, rec.ID)
+	if err != nil || rec.Metadata == nil {
+		return err
+	}
+
+	fields := metadataFields(rec.Metadata)
+	if len(fields) == 0 {
+		return nil
+	}
+	meta := s.metaKey(rec.ID)
+	_, err = s.Client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		p.Del(ctx, meta)
+		p.HSet(ctx, meta, fields...)
+		p.Expire(ctx, meta, time.Duration(age)*time.Second)
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,124 @@
+package redistore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	newStore := func(prefix string) *RediStore {
+		store, err := NewRediStore([]string{setup()}, false, []byte("secret-key"))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		store.SetKeyPrefix(prefix)
+		store.SetUserIDFunc(UserIDFromValue("user_id"))
+		store.SetSessionMetadata(true)
+		return store
+	}
+	src, dst := newStore("export_test_"), newStore("import_test_")
+	defer func() {
+		if err := src.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	defer func() {
+		if err := dst.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	defer src.DestroyUserSessions(ctx, "liam")
+	defer dst.DestroyUserSessions(ctx, "liam")
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Set("User-Agent", "exporter")
+	session, _ := src.New(req, "session-key")
+	session.Values["user_id"] = "liam"
+	session.Values["flash"] = &FlashMessage{42, "foo"}
+	session.Options.MaxAge = 3600
+	if err := src.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+
+	var buf bytes.Buffer
+	var progress []int
+	n, err := src.Export(ctx, &buf, TransferOptions{Progress: func(n int) { progress = append(progress, n) }})
+	if err != nil || n != 1 || len(progress) != 1 {
+		t.Fatalf("Expected 1 exported session; Got %d, %v, %v", n, progress, err)
+	}
+	exported := buf.String()
+
+	n, err = dst.Import(ctx, strings.NewReader(exported), TransferOptions{DryRun: true})
+	if err != nil || n != 1 {
+		t.Fatalf("Expected 1 validated session; Got %d, %v", n, err)
+	}
+	if _, err = dst.LookupSession(ctx, session.ID); err != ErrSessionNotFound {
+		t.Fatalf("Expected dry run not to write; Got %v", err)
+	}
+
+	if n, err = dst.Import(ctx, strings.NewReader(exported), TransferOptions{}); err != nil || n != 1 {
+		t.Fatalf("Expected 1 imported session; Got %d, %v", n, err)
+	}
+	rec, err := dst.LookupSession(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("Error looking up session: %v", err)
+	}
+	if flash, ok := rec.Values["flash"].(FlashMessage); !ok || flash.Message != "foo" {
+		t.Errorf("Expected raw payload to round trip; Got %#v", rec.Values)
+	}
+	if rec.TTL <= 0 || rec.TTL > time.Hour {
+		t.Errorf("Expected TTL to be kept; Got %v", rec.TTL)
+	}
+	if rec.Metadata == nil || rec.Metadata.UserAgent != "exporter" || rec.Metadata.CreatedAt.IsZero() {
+		t.Errorf("Expected metadata to be kept; Got %+v", rec.Metadata)
+	}
+	if ids, _ := dst.ListUserSessions(ctx, "liam"); len(ids) != 1 || ids[0] != session.ID {
+		t.Errorf("Expected session to be indexed; Got %v", ids)
+	}
+}
+
+func TestImportDecoded(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewRediStore([]string{setup()}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	store.SetKeyPrefix("import_test_")
+	store.SetSerializer(JSONSerializer{})
+	defer store.DestroySession(ctx, "DECODED")
+
+	in := `{"id":"DECODED","ttl_ms":60000,"values":{"foo":"bar","n":1}}` + "\n"
+	if _, err = store.Import(ctx, strings.NewReader(in), TransferOptions{}); err != nil {
+		t.Fatalf("Error importing: %v", err)
+	}
+	rec, err := store.LookupSession(ctx, "DECODED")
+	if err != nil || rec.Values["foo"] != "bar" || rec.Values["n"] != float64(1) {
+		t.Errorf("Unexpected session %+v, %v", rec, err)
+	}
+
+	var buf bytes.Buffer
+	if _, err = store.Export(ctx, &buf, TransferOptions{Decode: true}); err != nil {
+		t.Fatalf("Error exporting: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"values":{"foo":"bar","n":1}`) {
+		t.Errorf("Expected decoded values in %s", buf.String())
+	}
+
+	for _, bad := range []string{`{"ttl_ms":1}`, `{"id":"X"}`, `not json`} {
+		if n, err := store.Import(ctx, strings.NewReader(bad), TransferOptions{}); err == nil || n != 0 {
+			t.Errorf("%s: expected an error; Got %d, %v", bad, n, err)
+		}
+	}
+}
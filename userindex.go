@@ -0,0 +1,362 @@
+package redistore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/redis/go-redis/v9"
+)
+
+// UserIDFunc extracts the ID of the user owning a session. It returns an
+// empty string for anonymous sessions.
+type UserIDFunc func(session *sessions.Session) string
+
+// UserIDFromValue returns a UserIDFunc that reads the user ID from
+// session.Values[key]. Strings are used as is and numbers are formatted in
+// decimal, so an ID stored as an int and read back by JSONSerializer as a
+// float64 maps to the same user.
+func UserIDFromValue(key interface{}) UserIDFunc {
+	return func(session *sessions.Session) string {
+		switch v := session.Values[key].(type) {
+		case nil:
+			return ""
+		case string:
+			return v
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		case float32:
+			return strconv.FormatFloat(float64(v), 'f', -1, 32)
+		default:
+			return fmt.Sprint(v)
+		}
+	}
+}
+
+// SetUserIDFunc enables the per-user session index. Once set, every Save of a
+// session for which fn returns a user ID records the session in a sorted set
+// owned by that user, which backs ListUserSessions and DestroyUserSessions.
+// Pass nil to disable the index again.
+//
+// To keep a user's sessions and their index in the same Redis Cluster slot,
+// the IDs of indexed sessions carry a hash tag derived from the user ID. The
+// session ID therefore changes (and the cookie is reissued) when a session is
+// first saved with a user, or when its user changes.
+func (s *RediStore) SetUserIDFunc(fn UserIDFunc) {
+	s.userIDFunc = fn
+}
+
+// EvictionPolicy selects what happens when saving a session would take a user
+// over the limit set with SetMaxUserSessions.
+type EvictionPolicy int
+
+const (
+	// EvictOldest deletes the user's sessions that were created first.
+	EvictOldest EvictionPolicy = iota
+	// EvictLeastRecentlyUsed deletes the user's sessions that were loaded or
+	// saved least recently.
+	EvictLeastRecentlyUsed
+	// RejectNewSession refuses to save the new session and returns a
+	// *SessionLimitError from Save.
+	RejectNewSession
+)
+
+// SessionLimitError is returned by Save when the policy is RejectNewSession
+// and the user already holds the maximum number of sessions.
+type SessionLimitError struct {
+	UserID string
+	Limit  int
+}
+
+func (e *SessionLimitError) Error() string {
+	return fmt.Sprintf("redistore: user %q already has %d sessions", e.UserID, e.Limit)
+}
+
+// SetMaxUserSessions limits the number of live sessions a single user may
+// hold to n, applying policy when a new session would exceed it. Sessions
+// already in the index can always be saved again. The check and any eviction
+// run atomically in Redis, so concurrent logins on different instances cannot
+// exceed the limit. A value of 0 removes the limit.
+//
+// The limit is only enforced while the user index is enabled with
+// SetUserIDFunc.
+func (s *RediStore) SetMaxUserSessions(n int, policy EvictionPolicy) {
+	if n >= 0 {
+		s.maxUserSessions = n
+		s.evictionPolicy = policy
+	}
+}
+
+// ListUserSessions returns the IDs of the live sessions belonging to userID,
+// oldest first. Index entries whose session has expired are removed as a side
+// effect.
+func (s *RediStore) ListUserSessions(ctx context.Context, userID string) ([]string, error) {
+	return listUserSessionsScript.Run(ctx, s.Client, s.userIndexKeys(userTag(userID)), s.keyPrefix).StringSlice()
+}
+
+// DestroyUserSessions deletes every session belonging to userID along with the
+// user's index, and returns the number of sessions deleted. The sessions and
+// the index are removed atomically.
+func (s *RediStore) DestroyUserSessions(ctx context.Context, userID string) (int, error) {
+	n, err := destroyUserSessionsScript.Run(ctx, s.Client, s.userIndexKeys(userTag(userID)), s.keyPrefix).Int()
+	if n > 0 {
+		s.invalidate(ctx, "*")
+	}
+	return n, err
+}
+
+// userIndexKey returns the key of the sorted set indexing the sessions of the
+// user identified by tag, scored by the time each session was first saved.
+func (s *RediStore) userIndexKey(tag string) string {
+	return s.keyPrefix + "user:{" + tag + "}"
+}
+
+// userLRUKey returns the key of the sorted set holding the same sessions as
+// userIndexKey, scored by the time each session was last loaded or saved.
+func (s *RediStore) userLRUKey(tag string) string {
+	return s.userIndexKey(tag) + ":lru"
+}
+
+// userIndexKeys returns both index keys of the user identified by tag.
+func (s *RediStore) userIndexKeys(tag string) []string {
+	return []string{s.userIndexKey(tag), s.userLRUKey(tag)}
+}
+
+// retagID makes sure the ID of session carries the hash tag of its current
+// user, regenerating it if not. Records stored under a previous ID are
+// removed so they cannot be resurrected by an old cookie.
+func (s *RediStore) retagID(session *sessions.Session) error {
+	tag := ""
+	if uid := s.userIDFunc(session); uid != "" {
+		tag = userTag(uid)
+	}
+	if session.ID != "" && idTag(session.ID) == tag {
+		return nil
+	}
+	if session.ID != "" {
+		if err := s.delete(session); err != nil {
+			return err
+		}
+	}
+	session.ID = newSessionID()
+	if tag != "" {
+		session.ID = "{" + tag + "}" + session.ID
+	}
+	return nil
+}
+
+// touchLRU records the use of a loaded session in its user's LRU index, for
+// EvictLeastRecentlyUsed. Sessions that are not indexed are left alone.
+func (s *RediStore) touchLRU(ctx context.Context, session *sessions.Session) error {
+	tag := idTag(session.ID)
+	if tag == "" || s.maxUserSessions == 0 || s.evictionPolicy != EvictLeastRecentlyUsed {
+		return nil
+	}
+	return s.Client.ZAddXX(ctx, s.userLRUKey(tag), redis.Z{Score: float64(time.Now().UnixMilli()), Member: session.ID}).Err()
+}
+
+// userTag derives the hash tag used for the sessions of userID. Hashing keeps
+// arbitrary user IDs from breaking the tag syntax.
+func userTag(userID string) string {
+	sum := sha256.Sum256([]byte(userID))
+	return hex.EncodeToString(sum[:16])
+}
+
+// idTag returns the user hash tag embedded in a session ID, or an empty
+// string for anonymous session IDs.
+func idTag(id string) string {
+	if !strings.HasPrefix(id, "{") {
+		return ""
+	}
+	end := strings.IndexByte(id, '}')
+	if end < 0 {
+		return ""
+	}
+	return id[1:end]
+}
+
+// saveIndexed stores an indexed session and records it in its user's index,
+// enforcing the per-user session limit if one is set. With an ack, the
+// script is sent in a pipeline followed by WAIT.
+func (s *RediStore) saveIndexed(ctx context.Context, session *sessions.Session, b []byte, age int, ack *SaveAck) error {
+	keys, args := s.saveIndexedArgs(session, b, age)
+	var save *redis.Cmd
+	var wait *redis.Cmd
+	if ack == nil {
+		save = saveIndexedScript.Run(ctx, s.Client, keys, args...)
+	} else {
+		c, err := s.ackClient(ctx, keys[0])
+		if err != nil {
+			return err
+		}
+		if _, err := c.Pipelined(ctx, func(p redis.Pipeliner) error {
+			// EVALSHA could not fall back to EVAL within the pipeline.
+			save = saveIndexedScript.Eval(ctx, p, keys, args...)
+			wait = ack.queue(ctx, p)
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	n, err := save.Int()
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return &SessionLimitError{UserID: s.userIDFunc(session), Limit: s.maxUserSessions}
+	}
+	if n > 0 {
+		// The IDs of the evicted sessions are not known here.
+		s.invalidate(ctx, "*")
+	}
+	return ack.check(wait)
+}
+
+// saveIndexedArgs returns the keys and arguments of saveIndexedScript.
+func (s *RediStore) saveIndexedArgs(session *sessions.Session, b []byte, age int) ([]string, []interface{}) {
+	tag := idTag(session.ID)
+	keys := []string{s.keyPrefix + session.ID, s.userIndexKey(tag), s.userLRUKey(tag)}
+	args := []interface{}{b, age, session.ID, time.Now().UnixMilli(), s.keyPrefix, s.maxUserSessions, int(s.evictionPolicy)}
+	return keys, args
+}
+
+// The scripts of the user index read and write the session and metadata
+// keys of the sessions in the index, which they derive from the key prefix
+// and the indexed IDs rather than receive in KEYS, as the sessions of a user
+// are only known once the index is read. This departs from the scripting
+// contract and relies on the IDs of indexed sessions embedding the user's
+// hash tag: all those keys hash to the slot of the index keys, so the
+// scripts work on Redis Cluster.
+
+// indexPruneBatch is how many of the oldest entries of a user index a save
+// checks for sessions that no longer exist.
+const indexPruneBatch = 16
+
+// saveIndexedScript stores the session, adds it to the user's indexes and
+// drops entries whose session no longer exists among the oldest ones, as
+// sessions mostly expire in the order they were created. The whole index is
+// only pruned when it holds as many sessions as the limit, so expired
+// sessions never count against it. The indexes live at least as long as the
+// session just saved. When a limit is given and the session is not yet
+// indexed, older sessions and their metadata are evicted to make room, or -1
+// is returned without saving anything if the policy is RejectNewSession.
+// Otherwise the number of evicted sessions is returned.
+//
+// KEYS[1] session key, KEYS[2] user index key, KEYS[3] user LRU key.
+// ARGV[1] payload, ARGV[2] TTL in seconds, ARGV[3] session ID,
+// ARGV[4] now in milliseconds, ARGV[5] key prefix, ARGV[6] session limit,
+// ARGV[7] eviction policy.
+var saveIndexedScript = redis.NewScript(`
+local function prune(stop)
+  for _, id in ipairs(redis.call('ZRANGE', KEYS[2], 0, stop)) do
+    if redis.call('EXISTS', ARGV[5] .. id) == 0 then
+      redis.call('ZREM', KEYS[2], id)
+      redis.call('ZREM', KEYS[3], id)
+    end
+  end
+end
+prune(` + strconv.Itoa(indexPruneBatch-1) + `)
+local evicted = 0
+local limit = tonumber(ARGV[6])
+if limit > 0 and not redis.call('ZSCORE', KEYS[2], ARGV[3]) then
+  local excess = redis.call('ZCARD', KEYS[2]) - limit + 1
+  if excess > 0 then
+    prune(-1)
+    excess = redis.call('ZCARD', KEYS[2]) - limit + 1
+  end
+  if excess > 0 then
+    if ARGV[7] == '2' then
+      return -1
+    end
+    local order = KEYS[2]
+    if ARGV[7] == '1' then
+      order = KEYS[3]
+    end
+    for _, id in ipairs(redis.call('ZRANGE', order, 0, excess - 1)) do
+      redis.call('DEL', ARGV[5] .. id, ARGV[5] .. id .. ':meta')
+      redis.call('ZREM', KEYS[2], id)
+      redis.call('ZREM', KEYS[3], id)
+      evicted = evicted + 1
+    end
+  end
+end
+redis.call('SET', KEYS[1], ARGV[1], 'EX', ARGV[2])
+redis.call('ZADD', KEYS[2], 'NX', ARGV[4], ARGV[3])
+redis.call('ZADD', KEYS[3], ARGV[4], ARGV[3])
+local ttl = tonumber(ARGV[2])
+for i = 2, 3 do
+  if redis.call('TTL', KEYS[i]) < ttl then
+    redis.call('EXPIRE', KEYS[i], ttl)
+  end
+end
+return evicted
+`)
+
+// deleteIndexedScript removes a session, its metadata and its index entries,
+// returning 1 if the session existed.
+//
+// KEYS[1] session key, KEYS[2] user index key, KEYS[3] user LRU key,
+// KEYS[4] session metadata key. ARGV[1] session ID.
+var deleteIndexedScript = redis.NewScript(`
+local n = redis.call('DEL', KEYS[1])
+redis.call('DEL', KEYS[4])
+redis.call('ZREM', KEYS[2], ARGV[1])
+redis.call('ZREM', KEYS[3], ARGV[1])
+return n
+`)
+
+// extendIndexedScript sets the TTL of an existing session and its metadata,
+// and extends the user's indexes to live at least as long. It returns 0 if
+// the session does not exist.
+//
+// KEYS[1] session key, KEYS[2] user index key, KEYS[3] user LRU key,
+// KEYS[4] session metadata key. ARGV[1] TTL in seconds.
+var extendIndexedScript = redis.NewScript(`
+local ttl = tonumber(ARGV[1])
+if redis.call('EXPIRE', KEYS[1], ttl) == 0 then
+  return 0
+end
+redis.call('EXPIRE', KEYS[4], ttl)
+for i = 2, 3 do
+  if redis.call('TTL', KEYS[i]) < ttl then
+    redis.call('EXPIRE', KEYS[i], ttl)
+  end
+end
+return 1
+`)
+
+// listUserSessionsScript returns the live members of a user index, pruning
+// the stale ones.
+//
+// KEYS[1] user index key, KEYS[2] user LRU key. ARGV[1] key prefix.
+var listUserSessionsScript = redis.NewScript(`
+local live = {}
+for _, id in ipairs(redis.call('ZRANGE', KEYS[1], 0, -1)) do
+  if redis.call('EXISTS', ARGV[1] .. id) == 1 then
+    table.insert(live, id)
+  else
+    redis.call('ZREM', KEYS[1], id)
+    redis.call('ZREM', KEYS[2], id)
+  end
+end
+return live
+`)
+
+// destroyUserSessionsScript deletes all sessions in a user index and the
+// indexes themselves, returning the number of sessions deleted.
+//
+// KEYS[1] user index key, KEYS[2] user LRU key. ARGV[1] key prefix.
+var destroyUserSessionsScript = redis.NewScript(`
+local n = 0
+for _, id in ipairs(redis.call('ZRANGE', KEYS[1], 0, -1)) do
+  n = n + redis.call('DEL', ARGV[1] .. id)
+  redis.call('DEL', ARGV[1] .. id .. ':meta')
+end
+redis.call('DEL', KEYS[1], KEYS[2])
+return n
+`)
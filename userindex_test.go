@@ -0,0 +1,299 @@
+package redistore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/redis/go-redis/v9"
+)
+
+// saveUserSession saves a new session for uid and returns it.
+func saveUserSession(t *testing.T, store *RediStore, uid interface{}) *sessions.Session {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "session-key")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if uid != nil {
+		session.Values["user_id"] = uid
+	}
+	if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	return session
+}
+
+func TestUserIndex(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewRediStore([]string{setup()}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	store.SetKeyPrefix("userindex_test_")
+	store.SetUserIDFunc(UserIDFromValue("user_id"))
+	defer store.DestroyUserSessions(ctx, "42")
+	defer store.DestroyUserSessions(ctx, "bob")
+
+	a := saveUserSession(t, store, 42)
+	b := saveUserSession(t, store, 42)
+	c := saveUserSession(t, store, "bob")
+	if idTag(a.ID) == "" || idTag(a.ID) != idTag(b.ID) || idTag(a.ID) == idTag(c.ID) {
+		t.Fatalf("Unexpected hash tags in %q, %q, %q", a.ID, b.ID, c.ID)
+	}
+
+	ids, err := store.ListUserSessions(ctx, "42")
+	if err != nil {
+		t.Fatalf("Error listing sessions: %v", err)
+	}
+	want := []string{a.ID, b.ID}
+	sort.Strings(ids)
+	sort.Strings(want)
+	if len(ids) != 2 || ids[0] != want[0] || ids[1] != want[1] {
+		t.Errorf("Expected %v; Got %v", want, ids)
+	}
+
+	// Deleting a session removes it from the index.
+	b.Options.MaxAge = -1
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	if err = store.Save(req, httptest.NewRecorder(), b); err != nil {
+		t.Fatalf("Error deleting session: %v", err)
+	}
+	if n, _ := store.Client.ZCard(ctx, store.userIndexKey(idTag(a.ID))).Result(); n != 1 {
+		t.Errorf("Expected 1 index entry; Got %d", n)
+	}
+
+	n, err := store.DestroyUserSessions(ctx, "42")
+	if err != nil || n != 1 {
+		t.Fatalf("Expected 1 session destroyed; Got %d, %v", n, err)
+	}
+	if ok, _ := store.load(a); ok {
+		t.Error("Expected destroyed session to be gone")
+	}
+	if ids, _ = store.ListUserSessions(ctx, "bob"); len(ids) != 1 || ids[0] != c.ID {
+		t.Errorf("Expected bob's session to survive; Got %v", ids)
+	}
+}
+
+func TestUserIndexRetag(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewRediStore([]string{setup()}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	store.SetKeyPrefix("userindex_test_")
+	store.SetUserIDFunc(UserIDFromValue("user_id"))
+	defer store.DestroyUserSessions(ctx, "carol")
+
+	session := saveUserSession(t, store, nil)
+	anonymous := session.ID
+	if idTag(anonymous) != "" {
+		t.Fatalf("Expected untagged ID for anonymous session; Got %q", anonymous)
+	}
+
+	// Logging in moves the session under the user's tag.
+	session.Values["user_id"] = "carol"
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	rsp := httptest.NewRecorder()
+	if err = store.Save(req, rsp, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	if session.ID == anonymous || idTag(session.ID) != userTag("carol") {
+		t.Errorf("Expected ID to be retagged; Got %q", session.ID)
+	}
+	if n, _ := store.Client.Exists(ctx, "userindex_test_"+anonymous).Result(); n != 0 {
+		t.Error("Expected anonymous record to be deleted")
+	}
+	if len(rsp.Result().Cookies()) != 1 {
+		t.Error("Expected the cookie to be reissued")
+	}
+	if ids, _ := store.ListUserSessions(ctx, "carol"); len(ids) != 1 || ids[0] != session.ID {
+		t.Errorf("Expected %q in index; Got %v", session.ID, ids)
+	}
+
+	// Saving again keeps the ID.
+	tagged := session.ID
+	if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	if session.ID != tagged {
+		t.Errorf("Expected ID %q to be kept; Got %q", tagged, session.ID)
+	}
+}
+
+func TestUserIDFromValue(t *testing.T) {
+	fn := UserIDFromValue("uid")
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{nil, ""},
+		{"alice", "alice"},
+		{42, "42"},
+		{int64(42), "42"},
+		{float64(42), "42"},
+		{float64(12345678901), "12345678901"},
+	}
+	for _, tt := range tests {
+		session := sessions.NewSession(nil, "s")
+		if tt.value != nil {
+			session.Values["uid"] = tt.value
+		}
+		if got := fn(session); got != tt.want {
+			t.Errorf("UserIDFromValue(%#v) = %q; want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestMaxUserSessions(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewRediStore([]string{setup()}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	store.SetKeyPrefix("userlimit_test_")
+	store.SetUserIDFunc(UserIDFromValue("user_id"))
+	defer store.DestroyUserSessions(ctx, "dave")
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+
+	store.SetMaxUserSessions(2, EvictOldest)
+	first := saveUserSession(t, store, "dave")
+	time.Sleep(2 * time.Millisecond)
+	second := saveUserSession(t, store, "dave")
+	time.Sleep(2 * time.Millisecond)
+	third := saveUserSession(t, store, "dave")
+	if ids, _ := store.ListUserSessions(ctx, "dave"); len(ids) != 2 || ids[0] != second.ID || ids[1] != third.ID {
+		t.Errorf("Expected oldest session to be evicted; Got %v", ids)
+	}
+	if ok, _ := store.load(first); ok {
+		t.Error("Expected evicted session to be deleted")
+	}
+
+	store.SetMaxUserSessions(2, EvictLeastRecentlyUsed)
+	time.Sleep(2 * time.Millisecond)
+	if err = store.Save(req, httptest.NewRecorder(), second); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	fourth := saveUserSession(t, store, "dave")
+	if ids, _ := store.ListUserSessions(ctx, "dave"); len(ids) != 2 || ids[0] != second.ID || ids[1] != fourth.ID {
+		t.Errorf("Expected least recently used session to be evicted; Got %v", ids)
+	}
+
+	store.SetMaxUserSessions(2, RejectNewSession)
+	session, _ := store.New(req, "session-key")
+	session.Values["user_id"] = "dave"
+	err = store.Save(req, httptest.NewRecorder(), session)
+	var limitErr *SessionLimitError
+	if !errors.As(err, &limitErr) || limitErr.UserID != "dave" || limitErr.Limit != 2 {
+		t.Fatalf("Expected *SessionLimitError; Got %v", err)
+	}
+	if err = store.Save(req, httptest.NewRecorder(), fourth); err != nil {
+		t.Errorf("Expected indexed session to be saved; Got %v", err)
+	}
+	if ids, _ := store.ListUserSessions(ctx, "dave"); len(ids) != 2 {
+		t.Errorf("Expected 2 sessions; Got %v", ids)
+	}
+}
+
+func TestUserIndexLRULoads(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewRediStore([]string{setup()}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	store.SetKeyPrefix("userindex_test_")
+	store.SetUserIDFunc(UserIDFromValue("user_id"))
+	store.SetMaxUserSessions(2, EvictLeastRecentlyUsed)
+	defer store.DestroyUserSessions(ctx, "erin")
+
+	first := saveUserSession(t, store, "erin")
+	time.Sleep(2 * time.Millisecond)
+	second := saveUserSession(t, store, "erin")
+	time.Sleep(2 * time.Millisecond)
+
+	// Loading the first session makes it the most recently used, although
+	// it is not saved again.
+	encoded, err := securecookie.EncodeMulti("session-key", first.ID, store.Codecs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "http://localhost/", nil)
+	req.AddCookie(&http.Cookie{Name: "session-key", Value: encoded})
+	if session, err := store.New(req, "session-key"); err != nil || session.IsNew {
+		t.Fatalf("Expected the first session; Got %v", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	third := saveUserSession(t, store, "erin")
+	if ids, _ := store.ListUserSessions(ctx, "erin"); len(ids) != 2 || ids[0] != first.ID || ids[1] != third.ID {
+		t.Errorf("Expected %s to be evicted; Got %v", second.ID, ids)
+	}
+}
+
+func TestUserIndexPrune(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewRediStore([]string{setup()}, false, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing store: %v\n", err)
+		}
+	}()
+	store.SetKeyPrefix("userindex_test_")
+	store.SetUserIDFunc(UserIDFromValue("user_id"))
+	defer store.DestroyUserSessions(ctx, "frank")
+
+	// Entries of sessions that expired long ago.
+	tag := userTag("frank")
+	for i := 0; i < indexPruneBatch+4; i++ {
+		for _, key := range store.userIndexKeys(tag) {
+			member := redis.Z{Score: float64(i), Member: fmt.Sprintf("{%s}stale%02d", tag, i)}
+			if err := store.Client.ZAdd(ctx, key, member).Err(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// A save only prunes the oldest entries.
+	saveUserSession(t, store, "frank")
+	if n, err := store.Client.ZCard(ctx, store.userIndexKey(tag)).Result(); err != nil || n != 5 {
+		t.Errorf("Expected 4 stale entries and 1 session; Got %d, %v", n, err)
+	}
+
+	// Stale entries do not count against the limit.
+	store.SetMaxUserSessions(2, RejectNewSession)
+	saveUserSession(t, store, "frank")
+	if n, err := store.Client.ZCard(ctx, store.userIndexKey(tag)).Result(); err != nil || n != 2 {
+		t.Errorf("Expected 2 sessions; Got %d, %v", n, err)
+	}
+}
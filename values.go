@@ -0,0 +1,249 @@
+package redistore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/gorilla/sessions"
+)
+
+// Get returns the session value stored under key as a T, reporting whether
+// it exists and converts to T. Values are converted so that the same code
+// works whichever serializer stored them:
+//
+//   - A number converts to any numeric type that holds it exactly, so the
+//     float64 3 a JSONSerializer round trip produces is an int 3, while 3.5
+//     or -1 are not ints or uints respectively. json.Number converts alike.
+//   - A slice converts to a slice type element by element, and a map to a
+//     map type with string or numeric keys entry by entry, so the
+//     []interface{} of float64 JSON produces is a []int.
+//   - nil converts to the zero value of pointer, interface, slice and map
+//     types.
+//
+// Nothing else is converted; in particular numbers and strings do not
+// convert into each other.
+func Get[T any](session *sessions.Session, key interface{}) (T, bool) {
+	var zero T
+	v, ok := session.Values[key]
+	if !ok {
+		return zero, false
+	}
+	if t, ok := v.(T); ok {
+		return t, true
+	}
+	rv, ok := convertValue(reflect.ValueOf(v), reflect.TypeOf((*T)(nil)).Elem())
+	if !ok {
+		return zero, false
+	}
+	// The zero value of an interface type T, for a nil value, is a nil
+	// interface, which a plain assertion to T panics on.
+	t, _ := rv.Interface().(T)
+	return t, true
+}
+
+// Set stores value in the session under key.
+func Set[T any](session *sessions.Session, key interface{}, value T) {
+	session.Values[key] = value
+}
+
+// Delete removes the session value stored under key.
+func Delete(session *sessions.Session, key interface{}) {
+	delete(session.Values, key)
+}
+
+// Pop returns the session value stored under key like Get and removes it,
+// whether or not it converts to T.
+func Pop[T any](session *sessions.Session, key interface{}) (T, bool) {
+	v, ok := Get[T](session, key)
+	delete(session.Values, key)
+	return v, ok
+}
+
+// Bind copies session values into the fields of the struct dst points to.
+// Fields are matched by their `session:"key"` tag; untagged fields and
+// fields tagged "-" are left alone, as are fields whose key the session
+// lacks. Values are converted as by Get. Values that do not convert are
+// reported together in the returned error, and their fields left alone.
+//
+//	var u struct {
+//		ID    int      `session:"user_id"`
+//		Roles []string `session:"roles"`
+//	}
+//	err := redistore.Bind(session, &u)
+func Bind(session *sessions.Session, dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("redistore: Bind needs a non-nil pointer to a struct, not %T", dst)
+	}
+	rv = rv.Elem()
+	var errs []error
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		key, ok := field.Tag.Lookup("session")
+		key, _, _ = strings.Cut(key, ",")
+		if !ok || key == "" || key == "-" || !field.IsExported() {
+			continue
+		}
+		v, ok := session.Values[key]
+		if !ok {
+			continue
+		}
+		cv, ok := convertValue(reflect.ValueOf(v), field.Type)
+		if !ok {
+			errs = append(errs, fmt.Errorf("redistore: session value %q is a %T, not convertible to %s", key, v, field.Type))
+			continue
+		}
+		rv.Field(i).Set(cv)
+	}
+	return errors.Join(errs...)
+}
+
+// convertValue converts v to type t following the rules of Get.
+func convertValue(v reflect.Value, t reflect.Type) (reflect.Value, bool) {
+	if !v.IsValid() {
+		switch t.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map:
+			return reflect.Zero(t), true
+		}
+		return reflect.Value{}, false
+	}
+	if v.Type().AssignableTo(t) {
+		out := reflect.New(t).Elem()
+		out.Set(v)
+		return out, true
+	}
+	if v.Kind() == reflect.Interface {
+		return convertValue(v.Elem(), t)
+	}
+	if n, ok := v.Interface().(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			return convertValue(reflect.ValueOf(i), t)
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return reflect.Value{}, false
+		}
+		return convertValue(reflect.ValueOf(f), t)
+	}
+
+	switch {
+	case isNumeric(v.Kind()) && isNumeric(t.Kind()):
+		return convertNumber(v, t)
+	case t.Kind() == reflect.Slice && (v.Kind() == reflect.Slice || v.Kind() == reflect.Array):
+		out := reflect.MakeSlice(t, v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			e, ok := convertValue(v.Index(i), t.Elem())
+			if !ok {
+				return reflect.Value{}, false
+			}
+			out.Index(i).Set(e)
+		}
+		return out, true
+	case t.Kind() == reflect.Map && v.Kind() == reflect.Map:
+		out := reflect.MakeMapWithSize(t, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			k, ok := convertValue(iter.Key(), t.Key())
+			if !ok {
+				return reflect.Value{}, false
+			}
+			e, ok := convertValue(iter.Value(), t.Elem())
+			if !ok {
+				return reflect.Value{}, false
+			}
+			out.SetMapIndex(k, e)
+		}
+		return out, true
+	}
+	return reflect.Value{}, false
+}
+
+func isNumeric(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// convertNumber converts the number v to the numeric type t if t holds it
+// exactly.
+func convertNumber(v reflect.Value, t reflect.Type) (reflect.Value, bool) {
+	out := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64:
+		f, exact := toFloat(v)
+		if !exact || out.OverflowFloat(f) {
+			return reflect.Value{}, false
+		}
+		if t.Kind() == reflect.Float32 && float64(float32(f)) != f && !math.IsNaN(f) {
+			return reflect.Value{}, false
+		}
+		out.SetFloat(f)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch v.Kind() {
+		case reflect.Float32, reflect.Float64:
+			f := v.Float()
+			if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+				return reflect.Value{}, false
+			}
+			i = int64(f)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if v.Uint() > math.MaxInt64 {
+				return reflect.Value{}, false
+			}
+			i = int64(v.Uint())
+		default:
+			i = v.Int()
+		}
+		if out.OverflowInt(i) {
+			return reflect.Value{}, false
+		}
+		out.SetInt(i)
+	default: // unsigned
+		var u uint64
+		switch v.Kind() {
+		case reflect.Float32, reflect.Float64:
+			f := v.Float()
+			if f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 {
+				return reflect.Value{}, false
+			}
+			u = uint64(f)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if v.Int() < 0 {
+				return reflect.Value{}, false
+			}
+			u = uint64(v.Int())
+		default:
+			u = v.Uint()
+		}
+		if out.OverflowUint(u) {
+			return reflect.Value{}, false
+		}
+		out.SetUint(u)
+	}
+	return out, true
+}
+
+// toFloat returns the number v as a float64, reporting whether it is exact.
+func toFloat(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := v.Int()
+		f := float64(i)
+		return f, f < math.MaxInt64 && int64(f) == i
+	default:
+		u := v.Uint()
+		f := float64(u)
+		return f, f < math.MaxUint64 && uint64(f) == u
+	}
+}
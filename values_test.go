@@ -0,0 +1,143 @@
+package redistore
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestGet(t *testing.T) {
+	session := sessions.NewSession(nil, "session-key")
+	// What a JSONSerializer round trip produces.
+	if err := (JSONSerializer{}).Deserialize([]byte(`{
+		"user_id": 42, "ratio": 0.5, "neg": -1, "big": 1e300, "name": "gina",
+		"ids": [1, 2, 3], "mixed": [1, "a"], "scores": {"a": 1}, "none": null
+	}`), session); err != nil {
+		t.Fatal(err)
+	}
+	session.Values["num"] = json.Number("7")
+	session.Values["i8"] = int8(-5)
+	session.Values["tenth"] = 0.1
+	session.Values["odd"] = int64(1<<53 + 1)
+	session.Values["max"] = uint64(math.MaxUint64)
+
+	if v, ok := Get[int](session, "user_id"); !ok || v != 42 {
+		t.Errorf("Expected 42; Got %v, %v", v, ok)
+	}
+	if v, ok := Get[float64](session, "user_id"); !ok || v != 42 {
+		t.Errorf("Expected 42.0; Got %v, %v", v, ok)
+	}
+	if v, ok := Get[string](session, "name"); !ok || v != "gina" {
+		t.Errorf("Expected gina; Got %v, %v", v, ok)
+	}
+	if v, ok := Get[[]int](session, "ids"); !ok || !reflect.DeepEqual(v, []int{1, 2, 3}) {
+		t.Errorf("Expected [1 2 3]; Got %v, %v", v, ok)
+	}
+	if v, ok := Get[map[string]uint8](session, "scores"); !ok || v["a"] != 1 {
+		t.Errorf("Expected map[a:1]; Got %v, %v", v, ok)
+	}
+	if v, ok := Get[int64](session, "num"); !ok || v != 7 {
+		t.Errorf("Expected 7 from json.Number; Got %v, %v", v, ok)
+	}
+	if v, ok := Get[float32](session, "i8"); !ok || v != -5 {
+		t.Errorf("Expected -5; Got %v, %v", v, ok)
+	}
+	if v, ok := Get[float32](session, "ratio"); !ok || v != 0.5 {
+		t.Errorf("Expected 0.5; Got %v, %v", v, ok)
+	}
+	if v, ok := Get[[]string](session, "none"); !ok || v != nil {
+		t.Errorf("Expected a nil slice; Got %v, %v", v, ok)
+	}
+	if v, ok := Get[interface{}](session, "name"); !ok || v != "gina" {
+		t.Errorf("Expected gina as interface{}; Got %v, %v", v, ok)
+	}
+	if v, ok := Get[any](session, "none"); !ok || v != nil {
+		t.Errorf("Expected nil as any; Got %v, %v", v, ok)
+	}
+	if v, ok := Get[error](session, "none"); !ok || v != nil {
+		t.Errorf("Expected a nil error; Got %v, %v", v, ok)
+	}
+	session.Values["nil"] = nil
+	if v, ok := Pop[any](session, "nil"); !ok || v != nil {
+		t.Errorf("Expected Pop of nil as any to succeed; Got %v, %v", v, ok)
+	}
+
+	for name, ok := range map[string]bool{
+		"ratio as int":     ok2(Get[int](session, "ratio")),
+		"neg as uint":      ok2(Get[uint](session, "neg")),
+		"big as int64":     ok2(Get[int64](session, "big")),
+		"big as float32":   ok2(Get[float32](session, "big")),
+		"name as int":      ok2(Get[int](session, "name")),
+		"user as string":   ok2(Get[string](session, "user_id")),
+		"mixed as []int":   ok2(Get[[]int](session, "mixed")),
+		"missing":          ok2(Get[int](session, "missing")),
+		"none as int":      ok2(Get[int](session, "none")),
+		"i8 as uint16":     ok2(Get[uint16](session, "i8")),
+		"big as int8":      ok2(Get[int8](session, "big")),
+		"tenth as float32": ok2(Get[float32](session, "tenth")),
+		"odd as float64":   ok2(Get[float64](session, "odd")),
+		"max as float64":   ok2(Get[float64](session, "max")),
+	} {
+		if ok {
+			t.Errorf("Expected %s to fail", name)
+		}
+	}
+}
+
+func ok2[T any](_ T, ok bool) bool {
+	return ok
+}
+
+func TestSetDeletePop(t *testing.T) {
+	session := sessions.NewSession(nil, "session-key")
+	Set(session, "user_id", 42)
+	Set(session, "flash", "saved")
+	if v, ok := Pop[string](session, "flash"); !ok || v != "saved" {
+		t.Errorf("Expected saved; Got %v, %v", v, ok)
+	}
+	if _, ok := session.Values["flash"]; ok {
+		t.Error("Expected Pop to remove the value")
+	}
+	if _, ok := Pop[string](session, "user_id"); ok {
+		t.Error("Expected Pop of an int as string to fail")
+	}
+	if _, ok := session.Values["user_id"]; ok {
+		t.Error("Expected Pop to remove the value even if it does not convert")
+	}
+	Set(session, "a", 1)
+	Delete(session, "a")
+	if len(session.Values) != 0 {
+		t.Errorf("Expected no values; Got %v", session.Values)
+	}
+}
+
+func TestBind(t *testing.T) {
+	session := sessions.NewSession(nil, "session-key")
+	if err := (JSONSerializer{}).Deserialize([]byte(`{"user_id": 42, "roles": ["admin"], "name": 7, "ignored": 1}`), session); err != nil {
+		t.Fatal(err)
+	}
+	var dst struct {
+		ID       int      `session:"user_id"`
+		Roles    []string `session:"roles"`
+		Name     string   `session:"name"`
+		Email    string   `session:"email"`
+		Ignored  int      `session:"-"`
+		Untagged int
+		private  int `session:"user_id"`
+	}
+	dst.Name = "kept"
+	err := Bind(session, &dst)
+	if err == nil || !strings.Contains(err.Error(), `"name"`) {
+		t.Errorf("Expected an error for name; Got %v", err)
+	}
+	if dst.ID != 42 || !reflect.DeepEqual(dst.Roles, []string{"admin"}) || dst.Name != "kept" || dst.Ignored != 0 || dst.private != 0 {
+		t.Errorf("Unexpected result %+v", dst)
+	}
+	if err := Bind(session, dst); err == nil {
+		t.Error("Expected an error for a non-pointer")
+	}
+}